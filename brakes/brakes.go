@@ -0,0 +1,205 @@
+// Package brakes monitors the brake temperatures.
+package brakes
+
+import (
+	"fmt"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+type Options struct {
+	// Hot is the temperature above which a brake overheats. Default 650.
+	Hot float32
+	// Cold is the temperature below which a brake is too cold while driving. Default 100.
+	Cold float32
+	// ColdSpeed is the speed in m/s above which cold brakes are reported. Default 10.
+	ColdSpeed float32
+	// Hysteresis must be recovered before the alert is cleared. Default 25.
+	Hysteresis float32
+	// Thresholds are the temperatures for which the time above is summed.
+	// Default 300, 500 and Hot.
+	Thresholds []float32
+}
+
+func (o *Options) defaults() {
+	if o.Hot <= 0 {
+		o.Hot = 650
+	}
+	if o.Cold <= 0 {
+		o.Cold = 100
+	}
+	if o.ColdSpeed <= 0 {
+		o.ColdSpeed = 10
+	}
+	if o.Hysteresis <= 0 {
+		o.Hysteresis = 25
+	}
+	if len(o.Thresholds) == 0 {
+		o.Thresholds = []float32{300, 500, o.Hot}
+	}
+}
+
+type AlertKind int
+
+const (
+	Overheated AlertKind = iota
+	CooledDown
+	TooCold
+	WarmedUp
+)
+
+func (k AlertKind) String() string {
+	switch k {
+	case Overheated:
+		return "overheated"
+	case CooledDown:
+		return "cooled down"
+	case TooCold:
+		return "too cold"
+	case WarmedUp:
+		return "warmed up"
+	}
+	return fmt.Sprintf("AlertKind(%d)", int(k))
+}
+
+type Alert struct {
+	Kind        AlertKind       `json:"kind"`
+	Wheel       packet.Position `json:"wheel"`
+	Temperature float32         `json:"temperature"`
+	StageTime   float32         `json:"stage_time"`
+	Distance    float64         `json:"distance"`
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("brake%s %v %.0f at %.0fm", a.Wheel, a.Kind, a.Temperature, a.Distance)
+}
+
+// Above is the time in seconds each brake spent above a temperature.
+type Above struct {
+	Threshold float32       `json:"threshold"`
+	Time      packet.Wheels `json:"time"`
+}
+
+// Stats are the brake temperatures of a stage.
+type Stats struct {
+	Peak    packet.Wheels `json:"peak"`
+	Average packet.Wheels `json:"average"`
+	// FrontShare and LeftShare are the share of the average temperature
+	// on the front axle and on the left side, 0.5 is balanced.
+	FrontShare float32 `json:"front_share"`
+	LeftShare  float32 `json:"left_share"`
+	Above      []Above `json:"above"`
+	Time       float64 `json:"time"`
+}
+
+// Monitor follows the brake temperatures, starting over at every stage
+// start: when the stage clock starts or goes back by more than
+// packet.RestartTolerance, or the route or vehicle changes.
+type Monitor struct {
+	opts      Options
+	started   bool
+	gameTime  float32
+	stageTime float32
+	routeID   uint16
+	vehicleID uint16
+	stats     Stats
+	sum       [4]float64
+	hot       [4]bool
+	cold      [4]bool
+}
+
+func New(opts Options) *Monitor {
+	opts.defaults()
+	m := &Monitor{opts: opts}
+	m.Reset()
+	return m
+}
+
+// Reset starts over, for callers that follow the stages themselves.
+func (m *Monitor) Reset() {
+	m.stats = Stats{}
+	for _, t := range m.opts.Thresholds {
+		m.stats.Above = append(m.stats.Above, Above{Threshold: t})
+	}
+	m.sum = [4]float64{}
+	m.hot = [4]bool{}
+	m.cold = [4]bool{}
+	m.started = false
+}
+
+// Update consumes a packet and returns the alerts it raised.
+func (m *Monitor) Update(p *packet.Packet) []Alert {
+	if m.started && (p.RouteID != m.routeID || p.VehicleID != m.vehicleID ||
+		p.Restarted(m.stageTime, packet.RestartTolerance) ||
+		m.stageTime == 0 && p.StageCurrentTime > 0) {
+		m.Reset()
+	}
+	started, last := m.started, m.gameTime
+	m.started, m.gameTime, m.stageTime = true, p.GameTotalTime, p.StageCurrentTime
+	m.routeID, m.vehicleID = p.RouteID, p.VehicleID
+	d := 0.0
+	if started {
+		d = float64(p.Elapsed(last))
+	}
+	m.stats.Time += d
+	alerts := []Alert{}
+	alert := func(kind AlertKind, pos packet.Position, t float32) {
+		alerts = append(alerts, Alert{Kind: kind, Wheel: pos, Temperature: t, StageTime: p.StageCurrentTime, Distance: p.StageCurrentDistance})
+	}
+	o := &m.opts
+	for i, pos := range packet.Positions {
+		t := p.BrakeTemperature(pos)
+		m.stats.Peak.Set(pos, max(m.stats.Peak.Get(pos), t))
+		m.sum[i] += float64(t) * d
+		for j := range m.stats.Above {
+			if above := &m.stats.Above[j]; t > above.Threshold {
+				above.Time.Set(pos, above.Time.Get(pos)+float32(d))
+			}
+		}
+		switch {
+		case !m.hot[i] && t > o.Hot:
+			m.hot[i] = true
+			alert(Overheated, pos, t)
+		case m.hot[i] && t < o.Hot-o.Hysteresis:
+			m.hot[i] = false
+			alert(CooledDown, pos, t)
+		}
+		switch {
+		case !m.cold[i] && t < o.Cold && p.VehicleSpeed > o.ColdSpeed:
+			m.cold[i] = true
+			alert(TooCold, pos, t)
+		case m.cold[i] && t > o.Cold+o.Hysteresis:
+			m.cold[i] = false
+			alert(WarmedUp, pos, t)
+		}
+	}
+	return alerts
+}
+
+// Stats returns the statistics of the current stage.
+func (m *Monitor) Stats() Stats {
+	s := m.stats
+	s.Above = append([]Above(nil), s.Above...)
+	if s.Time <= 0 {
+		return s
+	}
+	for i, pos := range packet.Positions {
+		s.Average.Set(pos, float32(m.sum[i]/s.Time))
+	}
+	a := s.Average
+	if total := a.Fl + a.Fr + a.Bl + a.Br; total > 0 {
+		s.FrontShare = (a.Fl + a.Fr) / total
+		s.LeftShare = (a.Fl + a.Bl) / total
+	}
+	return s
+}
+
+// Run returns the statistics and alerts of a run.
+func Run(packets []*packet.Packet, opts Options) (Stats, []Alert) {
+	m := New(opts)
+	alerts := []Alert{}
+	for _, p := range packets {
+		alerts = append(alerts, m.Update(p)...)
+	}
+	return m.Stats(), alerts
+}
@@ -0,0 +1,114 @@
+package brakes
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// frame returns a packet at i tenths of a second with the front left
+// brake at fl and the others at 200.
+func frame(i int, fl, speed float32) *packet.Packet {
+	p := packet.New()
+	p.RouteID, p.VehicleID = 7, 3
+	p.GameTotalTime = float32(i) / 10
+	p.StageCurrentTime = 1 + float32(i)/10
+	p.StageCurrentDistance = float64(i)
+	p.VehicleSpeed = speed
+	p.VehicleBrakeTemperatureFl = fl
+	p.VehicleBrakeTemperatureFr = 200
+	p.VehicleBrakeTemperatureBl = 200
+	p.VehicleBrakeTemperatureBr = 200
+	return p
+}
+
+func TestAlerts(t *testing.T) {
+	temps := []float32{600, 660, 700, 640, 620, 600, 50, 50, 110, 130}
+	speeds := []float32{20, 20, 20, 20, 20, 20, 5, 20, 20, 20}
+	packets := []*packet.Packet{}
+	for i, temp := range temps {
+		packets = append(packets, frame(i, temp, speeds[i]))
+	}
+	_, alerts := Run(packets, Options{})
+	got := []AlertKind{}
+	at := []float64{}
+	for _, a := range alerts {
+		if a.Wheel != packet.ForwardLeft {
+			t.Errorf("alert %v", a)
+		}
+		got = append(got, a.Kind)
+		at = append(at, a.Distance)
+	}
+	// cooled down only below the hysteresis, too cold only when moving
+	if want := []AlertKind{Overheated, CooledDown, TooCold, WarmedUp}; !reflect.DeepEqual(got, want) {
+		t.Errorf("alerts %v, want %v", got, want)
+	}
+	if want := []float64{1, 4, 7, 9}; !reflect.DeepEqual(at, want) {
+		t.Errorf("alerts at %v, want %v", at, want)
+	}
+}
+
+func TestStats(t *testing.T) {
+	packets := []*packet.Packet{}
+	for i := 0; i <= 10; i++ {
+		fl := float32(400)
+		if i > 5 {
+			fl = 700
+		}
+		packets = append(packets, frame(i, fl, 20))
+	}
+	s, _ := Run(packets, Options{})
+	near := func(a, b float32) bool { return math.Abs(float64(a-b)) < 1e-4 }
+	if !near(float32(s.Time), 1) || s.Peak.Fl != 700 || s.Peak.Fr != 200 {
+		t.Errorf("time %v, peak %+v", s.Time, s.Peak)
+	}
+	// the first packet only starts the clock
+	if !near(s.Average.Fl, 550) || !near(s.Average.Br, 200) {
+		t.Errorf("average %+v", s.Average)
+	}
+	if !near(s.FrontShare, 750.0/1150) || !near(s.LeftShare, 750.0/1150) {
+		t.Errorf("front share %v, left share %v", s.FrontShare, s.LeftShare)
+	}
+	want := []float32{1, 0.5, 0.5}
+	for i, a := range s.Above {
+		if !near(a.Time.Fl, want[i]) || a.Time.Fr != 0 {
+			t.Errorf("above %v: %+v, want %v", a.Threshold, a.Time, want[i])
+		}
+	}
+}
+
+func TestNewStage(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		next  func(p *packet.Packet)
+		reset bool
+	}{
+		{"same stage", func(p *packet.Packet) {}, false},
+		{"clock jitter", func(p *packet.Packet) { p.StageCurrentTime -= 0.3 }, false},
+		{"restart", func(p *packet.Packet) { p.StageCurrentTime = 0.1 }, true},
+		{"another route", func(p *packet.Packet) { p.RouteID = 8 }, true},
+		{"another vehicle", func(p *packet.Packet) { p.VehicleID = 4 }, true},
+	} {
+		m := New(Options{})
+		for i := 0; i < 5; i++ {
+			m.Update(frame(i, 700, 20))
+		}
+		p := frame(5, 300, 20)
+		tc.next(p)
+		m.Update(p)
+		if got := m.Stats().Peak.Fl == 300; got != tc.reset {
+			t.Errorf("%s: peak %v", tc.name, m.Stats().Peak.Fl)
+		}
+	}
+	// the stage clock starting counts as a new stage
+	m := New(Options{})
+	stopped := frame(0, 700, 0)
+	stopped.StageCurrentTime = 0
+	m.Update(stopped)
+	m.Update(frame(1, 300, 0))
+	if m.Stats().Peak.Fl != 300 {
+		t.Errorf("peak %v before the start kept", m.Stats().Peak.Fl)
+	}
+}
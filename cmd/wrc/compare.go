@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nobonobo/easportswrc/compare"
+	"github.com/nobonobo/easportswrc/packet"
+	"github.com/nobonobo/easportswrc/recording"
+)
+
+func init() {
+	commands["compare"] = command{
+		usage: "compare two stage runs by distance and write CSV to stdout",
+		run:   runCompare,
+	}
+}
+
+// stagePackets reads an argument of the form recording[:stage], stage 0 by default.
+func stagePackets(arg string) ([]*packet.Packet, error) {
+	name, stage := arg, 0
+	if i := strings.LastIndex(arg, ":"); i > 1 {
+		n, err := strconv.Atoi(arg[i+1:])
+		if err == nil {
+			name, stage = arg[:i], n
+		}
+	}
+	f, fp, err := recording.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return f.StagePackets(stage)
+}
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	step := fs.Float64("step", 5, "distance grid in metres")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wrc compare [flags] a.rec[:stage] b.rec[:stage]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	a, err := stagePackets(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := stagePackets(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	c, err := compare.Compare(a, b, *step)
+	if err != nil {
+		return err
+	}
+	return c.WriteCSV(os.Stdout)
+}
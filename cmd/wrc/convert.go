@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nobonobo/easportswrc/recording"
+)
+
+func init() {
+	commands["convert"] = command{
+		usage: "convert between raw and compressed recordings",
+		run:   runConvert,
+	}
+}
+
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	compress := fs.Bool("z", false, "write a compressed recording")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wrc convert [flags] input output")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := recording.Open(in)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	var w recording.RecordWriter = recording.NewWriter(out)
+	if *compress {
+		w = recording.NewCompressedWriter(out)
+	}
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.WriteData(rec.Time, rec.Data); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
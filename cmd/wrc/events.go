@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nobonobo/easportswrc/recording"
+	"github.com/nobonobo/easportswrc/session"
+)
+
+func init() {
+	commands["events"] = command{
+		usage: "print the stage lifecycle events of a recording",
+		run:   runEvents,
+	}
+}
+
+func runEvents(args []string) error {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wrc events recording")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := recording.Open(in)
+	if err != nil {
+		return err
+	}
+	t := session.NewTracker()
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		events, err := t.Datagram(rec.Data)
+		if err != nil {
+			continue
+		}
+		for _, ev := range events {
+			fmt.Println(rec.Time.Format("15:04:05.000"), ev.String())
+		}
+	}
+	for _, ev := range t.Idle() {
+		fmt.Println(ev.String())
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nobonobo/easportswrc/jsonl"
+	"github.com/nobonobo/easportswrc/recording"
+)
+
+func init() {
+	commands["jsonl"] = command{
+		usage: "convert a recording to JSON Lines on stdout, or back with -r",
+		run:   runJSONL,
+	}
+}
+
+func runJSONL(args []string) error {
+	fs := flag.NewFlagSet("jsonl", flag.ExitOnError)
+	reverse := fs.Bool("r", false, "read JSON Lines from stdin and write a recording")
+	names := fs.Bool("names", false, "add resolved names of ID channels")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wrc jsonl [flags] recording")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *reverse {
+		out, err := os.Create(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		r := jsonl.NewReader(os.Stdin)
+		w := recording.NewWriter(out)
+		for {
+			t, p, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if t.IsZero() {
+				// records without a time, UnixNano is undefined for the zero time
+				t = time.Unix(0, 0)
+			}
+			if err := w.Write(t, p); err != nil {
+				return err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return out.Close()
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := recording.Open(in)
+	if err != nil {
+		return err
+	}
+	w := jsonl.NewWriter(os.Stdout)
+	w.Names = *names
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		p, err := rec.Packet()
+		if err != nil {
+			continue
+		}
+		if err := w.Write(rec.Time, p); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,43 @@
+// Command wrc converts and inspects recorded WRC telemetry.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wrc <command> [arguments]")
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nobonobo/easportswrc/csvlog"
+	"github.com/nobonobo/easportswrc/jsonl"
+	"github.com/nobonobo/easportswrc/motec"
+	"github.com/nobonobo/easportswrc/packet"
+	"github.com/nobonobo/easportswrc/pcap"
+	"github.com/nobonobo/easportswrc/recording"
+)
+
+func init() {
+	commands["pcap"] = command{
+		usage: "convert a pcap/pcapng capture to a recording, csv, jsonl or ld file",
+		run:   runPcap,
+	}
+}
+
+func runPcap(args []string) error {
+	fs := flag.NewFlagSet("pcap", flag.ExitOnError)
+	port := fs.Int("port", 20777, "UDP destination port")
+	format := fs.String("format", "rec", "output format: rec, csv, jsonl or ld")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wrc pcap [flags] input output")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := pcap.NewReader(in, *port)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	switch *format {
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	case "rec":
+		w := recording.NewWriter(out)
+		for {
+			t, b, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := w.WriteData(t, b); err != nil {
+				return err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	case "csv":
+		w := csvlog.NewWriter(out)
+		w.Units = true
+		err := eachPacket(r, func(t time.Time, p *packet.Packet) error {
+			return w.Write(p)
+		})
+		if err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	case "jsonl":
+		w := jsonl.NewWriter(out)
+		err := eachPacket(r, func(t time.Time, p *packet.Packet) error {
+			return w.Write(t, p)
+		})
+		if err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	case "ld":
+		ld := &motec.LD{}
+		err := eachPacket(r, func(t time.Time, p *packet.Packet) error {
+			if ld.Date.IsZero() {
+				ld.Date = t
+			}
+			ld.Packets = append(ld.Packets, p)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := ld.WriteTo(out); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+func eachPacket(r *pcap.Reader, fn func(t time.Time, p *packet.Packet) error) error {
+	for {
+		t, p, err := r.NextPacket()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(t, p); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nobonobo/easportswrc/recording"
+	"github.com/nobonobo/easportswrc/session"
+)
+
+func init() {
+	commands["runs"] = command{
+		usage: "print the stage run summaries of a recording as JSON Lines",
+		run:   runRuns,
+	}
+}
+
+func runRuns(args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wrc runs recording")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := recording.Open(in)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	b := session.NewBuilder()
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		_, run, err := b.Datagram(rec.Data)
+		if err != nil || run == nil {
+			continue
+		}
+		if err := enc.Encode(run); err != nil {
+			return err
+		}
+	}
+	if run := b.Flush(); run != nil {
+		return enc.Encode(run)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nobonobo/easportswrc/recording"
+)
+
+func init() {
+	commands["stages"] = command{
+		usage: "list the stages contained in a recording",
+		run:   runStages,
+	}
+}
+
+func runStages(args []string) error {
+	fs := flag.NewFlagSet("stages", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wrc stages recording")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, fp, err := recording.OpenFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	for i, s := range f.Stages() {
+		fmt.Printf("%3d %-24s %-32s %-32s %9.3fs %9.1fm/%.1fm %d records\n",
+			i, s.Location, s.Route, s.Vehicle, s.EndStageTime, s.EndDistance, s.StageLength, s.Records)
+	}
+	return nil
+}
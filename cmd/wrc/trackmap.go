@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nobonobo/easportswrc/recording"
+	"github.com/nobonobo/easportswrc/trackmap"
+)
+
+func init() {
+	commands["map"] = command{
+		usage: "draw the map of a route from recordings as SVG or GeoJSON",
+		run:   runMap,
+	}
+}
+
+func runMap(args []string) error {
+	fs := flag.NewFlagSet("map", flag.ExitOnError)
+	route := fs.Int("route", -1, "route ID, default the route of the first stage")
+	format := fs.String("format", "svg", "output format: svg or geojson")
+	colour := fs.String("colour", "", "colour by speed or gear")
+	markers := fs.Float64("markers", 1000, "distance marker interval in metres")
+	width := fs.Float64("width", 1000, "SVG width in pixels")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wrc map [flags] recording...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	b := trackmap.NewBuilder()
+	for _, name := range fs.Args() {
+		f, fp, err := recording.OpenFile(name)
+		if err != nil {
+			return err
+		}
+		for i, s := range f.Stages() {
+			if *route < 0 {
+				*route = int(s.RouteID)
+			}
+			if int(s.RouteID) != *route {
+				continue
+			}
+			packets, err := f.StagePackets(i)
+			if err != nil {
+				fp.Close()
+				return err
+			}
+			b.Add(packets)
+		}
+		fp.Close()
+	}
+	m, ok := b.Map(uint16(*route))
+	if !ok {
+		return fmt.Errorf("route %d not found", *route)
+	}
+	opts := trackmap.Options{MarkerInterval: *markers}
+	switch *colour {
+	default:
+		return fmt.Errorf("unknown colouring %s", *colour)
+	case "":
+	case "speed":
+		opts.Colour = trackmap.BySpeed
+	case "gear":
+		opts.Colour = trackmap.ByGear
+	}
+	switch *format {
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	case "svg":
+		return m.WriteSVG(os.Stdout, *width, opts)
+	case "geojson":
+		return m.WriteGeoJSON(os.Stdout, 0, 0, opts)
+	}
+}
@@ -0,0 +1,198 @@
+// Package compare aligns two runs of the same route by stage distance.
+package compare
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// Sample is a run interpolated at a distance.
+type Sample struct {
+	Time      float32 `json:"time"`
+	Speed     float32 `json:"speed"`
+	Throttle  float32 `json:"throttle"`
+	Brake     float32 `json:"brake"`
+	Clutch    float32 `json:"clutch"`
+	Steering  float32 `json:"steering"`
+	Handbrake float32 `json:"handbrake"`
+	Gear      uint8   `json:"gear"`
+}
+
+func sample(p *packet.Packet) Sample {
+	return Sample{
+		Time:      p.StageCurrentTime,
+		Speed:     p.VehicleSpeed,
+		Throttle:  p.VehicleThrottle,
+		Brake:     p.VehicleBrake,
+		Clutch:    p.VehicleClutch,
+		Steering:  p.VehicleSteering,
+		Handbrake: p.VehicleHandbrake,
+		Gear:      p.VehicleGearIndex,
+	}
+}
+
+func lerp(a, b, f float32) float32 {
+	return a + (b-a)*f
+}
+
+func interpolate(a, b Sample, f float32) Sample {
+	s := Sample{
+		Time:      lerp(a.Time, b.Time, f),
+		Speed:     lerp(a.Speed, b.Speed, f),
+		Throttle:  lerp(a.Throttle, b.Throttle, f),
+		Brake:     lerp(a.Brake, b.Brake, f),
+		Clutch:    lerp(a.Clutch, b.Clutch, f),
+		Steering:  lerp(a.Steering, b.Steering, f),
+		Handbrake: lerp(a.Handbrake, b.Handbrake, f),
+		Gear:      a.Gear,
+	}
+	if f >= 0.5 {
+		s.Gear = b.Gear
+	}
+	return s
+}
+
+// Trace is a run as samples at increasing distance.
+type Trace struct {
+	Distances []float64
+	Samples   []Sample
+}
+
+// NewTrace keeps the packets that advance the stage distance, dropping
+// the ones where the car stood still or went backwards.
+func NewTrace(packets []*packet.Packet) *Trace {
+	t := &Trace{}
+	for _, p := range packets {
+		if n := len(t.Distances); n > 0 && p.StageCurrentDistance <= t.Distances[n-1] {
+			continue
+		}
+		t.Distances = append(t.Distances, p.StageCurrentDistance)
+		t.Samples = append(t.Samples, sample(p))
+	}
+	return t
+}
+
+// Length returns the last distance of the trace.
+func (t *Trace) Length() float64 {
+	if len(t.Distances) == 0 {
+		return 0
+	}
+	return t.Distances[len(t.Distances)-1]
+}
+
+// At returns the sample interpolated at distance d, clamped to the trace.
+func (t *Trace) At(d float64) Sample {
+	n := len(t.Distances)
+	if n == 0 {
+		return Sample{}
+	}
+	i := sort.SearchFloat64s(t.Distances, d)
+	if i == 0 {
+		return t.Samples[0]
+	}
+	if i >= n {
+		return t.Samples[n-1]
+	}
+	d0, d1 := t.Distances[i-1], t.Distances[i]
+	return interpolate(t.Samples[i-1], t.Samples[i], float32((d-d0)/(d1-d0)))
+}
+
+// Point compares both runs at a distance. Differences are B minus A,
+// so a positive DeltaTime means B is behind A.
+type Point struct {
+	Distance      float64 `json:"distance"`
+	A             Sample  `json:"a"`
+	B             Sample  `json:"b"`
+	DeltaTime     float32 `json:"delta_time"`
+	SpeedDiff     float32 `json:"speed_diff"`
+	ThrottleDiff  float32 `json:"throttle_diff"`
+	BrakeDiff     float32 `json:"brake_diff"`
+	ClutchDiff    float32 `json:"clutch_diff"`
+	SteeringDiff  float32 `json:"steering_diff"`
+	HandbrakeDiff float32 `json:"handbrake_diff"`
+}
+
+type Comparison struct {
+	Step   float64 `json:"step"`
+	Points []Point `json:"points"`
+}
+
+// Compare resamples runs a and b at multiples of step metres over the distance both covered.
+func Compare(a, b []*packet.Packet, step float64) (*Comparison, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid step %g", step)
+	}
+	ta, tb := NewTrace(a), NewTrace(b)
+	if len(ta.Distances) == 0 || len(tb.Distances) == 0 {
+		return nil, fmt.Errorf("no distance covered")
+	}
+	start := math.Ceil(max(ta.Distances[0], tb.Distances[0])/step) * step
+	end := min(ta.Length(), tb.Length())
+	c := &Comparison{Step: step}
+	for i := 0; ; i++ {
+		d := start + float64(i)*step
+		if d > end {
+			break
+		}
+		sa, sb := ta.At(d), tb.At(d)
+		c.Points = append(c.Points, Point{
+			Distance:      d,
+			A:             sa,
+			B:             sb,
+			DeltaTime:     sb.Time - sa.Time,
+			SpeedDiff:     sb.Speed - sa.Speed,
+			ThrottleDiff:  sb.Throttle - sa.Throttle,
+			BrakeDiff:     sb.Brake - sa.Brake,
+			ClutchDiff:    sb.Clutch - sa.Clutch,
+			SteeringDiff:  sb.Steering - sa.Steering,
+			HandbrakeDiff: sb.Handbrake - sa.Handbrake,
+		})
+	}
+	return c, nil
+}
+
+var header = []string{
+	"distance", "delta_time",
+	"a_time", "b_time", "a_speed", "b_speed", "speed_diff",
+	"a_throttle", "b_throttle", "throttle_diff",
+	"a_brake", "b_brake", "brake_diff",
+	"a_clutch", "b_clutch", "clutch_diff",
+	"a_steering", "b_steering", "steering_diff",
+	"a_handbrake", "b_handbrake", "handbrake_diff",
+	"a_gear", "b_gear",
+}
+
+func f32(v float32) string {
+	return strconv.FormatFloat(float64(v), 'g', -1, 32)
+}
+
+// WriteCSV writes one row per point.
+func (c *Comparison) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, p := range c.Points {
+		row := []string{
+			strconv.FormatFloat(p.Distance, 'g', -1, 64), f32(p.DeltaTime),
+			f32(p.A.Time), f32(p.B.Time), f32(p.A.Speed), f32(p.B.Speed), f32(p.SpeedDiff),
+			f32(p.A.Throttle), f32(p.B.Throttle), f32(p.ThrottleDiff),
+			f32(p.A.Brake), f32(p.B.Brake), f32(p.BrakeDiff),
+			f32(p.A.Clutch), f32(p.B.Clutch), f32(p.ClutchDiff),
+			f32(p.A.Steering), f32(p.B.Steering), f32(p.SteeringDiff),
+			f32(p.A.Handbrake), f32(p.B.Handbrake), f32(p.HandbrakeDiff),
+			strconv.Itoa(int(p.A.Gear)), strconv.Itoa(int(p.B.Gear)),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,118 @@
+package compare
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// run returns packets at 10 Hz driving at speed from distance start,
+// standing still for a second at 100 m and rolling back a metre after it.
+func run(speed float32, start float64) []*packet.Packet {
+	packets := []*packet.Packet{}
+	d, t := start, float32(0)
+	for d < 500 {
+		p := packet.New()
+		p.StageCurrentTime = t
+		p.StageCurrentDistance = d
+		p.VehicleSpeed = speed
+		p.VehicleThrottle = float32(d / 500)
+		p.VehicleGearIndex = uint8(d / 100)
+		packets = append(packets, p)
+		t += 0.1
+		if d >= 100 && d < 100+float64(speed)/10 {
+			for i := 0; i < 10; i++ {
+				stopped := *p
+				stopped.StageCurrentTime = t
+				packets = append(packets, &stopped)
+				t += 0.1
+			}
+			back := *p
+			back.StageCurrentTime = t
+			back.StageCurrentDistance = d - 1
+			packets = append(packets, &back)
+			t += 0.1
+		}
+		d += float64(speed) / 10
+	}
+	return packets
+}
+
+func TestNewTrace(t *testing.T) {
+	tr := NewTrace(run(20, 0))
+	for i := 1; i < len(tr.Distances); i++ {
+		if tr.Distances[i] <= tr.Distances[i-1] {
+			t.Fatalf("distance %v after %v", tr.Distances[i], tr.Distances[i-1])
+		}
+	}
+	if s := tr.At(-5); s != tr.Samples[0] {
+		t.Errorf("before the start %+v, want the first sample", s)
+	}
+	if s := tr.At(1e6); s != tr.Samples[len(tr.Samples)-1] {
+		t.Errorf("after the end %+v, want the last sample", s)
+	}
+	// halfway between the samples at 198 and 200 m, gear changes at 200 m
+	if s := tr.At(199); math.Abs(float64(s.Throttle)-199.0/500) > 1e-5 || s.Gear != 2 {
+		t.Errorf("at 199m %+v", s)
+	}
+	if s := tr.At(198.9); s.Gear != 1 {
+		t.Errorf("at 198.9m gear %d, want 1", s.Gear)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a, b := run(20, 0), run(25, 3)
+	c, err := Compare(a, b, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Points) == 0 || c.Points[0].Distance != 10 {
+		t.Fatalf("points start at %v, want 10", c.Points)
+	}
+	last := c.Points[len(c.Points)-1]
+	if last.Distance > min(NewTrace(a).Length(), NewTrace(b).Length()) {
+		t.Errorf("last point at %v beyond the shorter run", last.Distance)
+	}
+	for _, p := range c.Points {
+		// both stood still as long after 100 m, so only the pace counts
+		want := float32((p.Distance-3)/25 - p.Distance/20)
+		if math.Abs(float64(p.DeltaTime-want)) > 1e-3 {
+			t.Errorf("at %vm delta %v, want %v", p.Distance, p.DeltaTime, want)
+		}
+		if p.SpeedDiff != 5 {
+			t.Errorf("at %vm speed diff %v, want 5", p.Distance, p.SpeedDiff)
+		}
+	}
+	for _, step := range []float64{0, -1} {
+		if _, err := Compare(a, b, step); err == nil {
+			t.Errorf("step %v accepted", step)
+		}
+	}
+	if _, err := Compare(a, nil, 10); err == nil {
+		t.Error("empty run accepted")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	c, err := Compare(run(20, 0), run(25, 3), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := c.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(c.Points)+1 || len(rows[0]) != len(header) {
+		t.Fatalf("%d rows of %d columns, want %d of %d", len(rows), len(rows[0]), len(c.Points)+1, len(header))
+	}
+	if rows[1][0] != "50" || rows[1][6] != "5" {
+		t.Errorf("first row %v", rows[1])
+	}
+}
@@ -0,0 +1,154 @@
+// Package csvlog reads and writes telemetry packets as CSV for spreadsheets and pandas.
+package csvlog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+const nameSuffix = "_name"
+
+type Writer struct {
+	// Fields selects the columns in order. Default is Packet.Fields().
+	Fields []string
+	// Units adds a row of channel units after the header.
+	Units bool
+	// Descriptions adds a row of channel descriptions after the header.
+	Descriptions bool
+	// Names adds a "<id>_name" column with the resolved name after each ID channel.
+	Names bool
+
+	w       *csv.Writer
+	columns []string
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: csv.NewWriter(w)}
+}
+
+func (w *Writer) header(p *packet.Packet) error {
+	fields := w.Fields
+	if len(fields) == 0 {
+		fields = p.Fields()
+	}
+	for _, key := range fields {
+		if _, ok := packet.ChannelDicts[key]; !ok {
+			return fmt.Errorf("channel %s not found", key)
+		}
+		w.columns = append(w.columns, key)
+		if _, ok := p.Name(key); ok && w.Names {
+			w.columns = append(w.columns, key+nameSuffix)
+		}
+	}
+	if err := w.w.Write(w.columns); err != nil {
+		return err
+	}
+	if w.Units {
+		if err := w.w.Write(w.meta(func(ch *packet.Channel) string { return ch.Units })); err != nil {
+			return err
+		}
+	}
+	if w.Descriptions {
+		if err := w.w.Write(w.meta(func(ch *packet.Channel) string { return ch.Description })); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) meta(fn func(ch *packet.Channel) string) []string {
+	row := make([]string, len(w.columns))
+	for i, key := range w.columns {
+		if ch, ok := packet.ChannelDicts[key]; ok {
+			row[i] = fn(ch)
+		}
+	}
+	return row
+}
+
+// Write writes p as one row. The header rows are written before the first packet.
+func (w *Writer) Write(p *packet.Packet) error {
+	if w.columns == nil {
+		if err := w.header(p); err != nil {
+			return err
+		}
+	}
+	row := make([]string, 0, len(w.columns))
+	for _, key := range w.columns {
+		if _, ok := packet.ChannelDicts[key]; !ok {
+			name, _ := p.Name(key[:len(key)-len(nameSuffix)])
+			row = append(row, name)
+			continue
+		}
+		s, err := p.FormatValue(key)
+		if err != nil {
+			return err
+		}
+		row = append(row, s)
+	}
+	return w.w.Write(row)
+}
+
+// Flush writes any buffered rows to the underlying writer.
+func (w *Writer) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type Reader struct {
+	// Units and Descriptions tell the rows following the header,
+	// as written with the same Writer options.
+	Units        bool
+	Descriptions bool
+
+	r       *csv.Reader
+	columns []string
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: csv.NewReader(r)}
+}
+
+func (r *Reader) header() error {
+	columns, err := r.r.Read()
+	if err != nil {
+		return err
+	}
+	for _, skip := range []bool{r.Units, r.Descriptions} {
+		if !skip {
+			continue
+		}
+		if _, err := r.r.Read(); err != nil {
+			return err
+		}
+	}
+	r.columns = columns
+	return nil
+}
+
+// Read reconstructs the next packet. Name columns are ignored and channels
+// missing from the file are left zero.
+func (r *Reader) Read() (*packet.Packet, error) {
+	if r.columns == nil {
+		if err := r.header(); err != nil {
+			return nil, err
+		}
+	}
+	row, err := r.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	p := packet.New()
+	for i, key := range r.columns {
+		if _, ok := packet.ChannelDicts[key]; !ok {
+			continue
+		}
+		if err := p.ParseValue(key, row[i]); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
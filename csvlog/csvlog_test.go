@@ -0,0 +1,91 @@
+package csvlog
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// diff returns the first channel whose formatted value differs.
+func diff(a, b *packet.Packet) string {
+	for _, key := range a.Fields() {
+		x, _ := a.FormatValue(key)
+		y, _ := b.FormatValue(key)
+		if x != y {
+			return key + " " + y + ", want " + x
+		}
+	}
+	return ""
+}
+
+func TestRoundTrip(t *testing.T) {
+	packets := []*packet.Packet{}
+	for i := 0; i < 3; i++ {
+		p := packet.New()
+		p.Packet4CC = [4]byte([]byte("sesu"))
+		p.PacketUID = math.MaxUint64 - uint64(i)
+		p.VehicleSpeed = 12.345678 * float32(i)
+		p.VehicleSteering = float32(math.Inf(-1))
+		p.StageCurrentDistance = 1234.5678901234
+		p.StageShakedown = i == 1
+		p.RouteID = 3
+		packets = append(packets, p)
+	}
+	// a zero 4CC is written as an empty value like the unit of the channel
+	packets[2].Packet4CC = [4]byte{}
+	for _, tc := range []struct{ units, descs, names bool }{
+		{false, false, false},
+		{true, false, true},
+		{false, true, false},
+		{true, true, true},
+	} {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		w.Units, w.Descriptions, w.Names = tc.units, tc.descs, tc.names
+		for _, p := range packets {
+			if err := w.Write(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		r := NewReader(buf)
+		r.Units, r.Descriptions = tc.units, tc.descs
+		for i, want := range packets {
+			got, err := r.Read()
+			if err != nil {
+				t.Fatalf("%+v: packet %d: %v", tc, i, err)
+			}
+			if d := diff(want, got); d != "" {
+				t.Errorf("%+v: packet %d: %s", tc, i, d)
+			}
+		}
+		if _, err := r.Read(); err != io.EOF {
+			t.Errorf("%+v: end %v, want EOF", tc, err)
+		}
+	}
+}
+
+func TestDataRowLikeUnits(t *testing.T) {
+	// every value of the row is empty like the units row
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Fields = []string{"packet_4cc", "packet_4cc"}
+	w.Units = true
+	p := packet.New()
+	if err := w.Write(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(buf)
+	r.Units = true
+	if _, err := r.Read(); err != nil {
+		t.Errorf("data row skipped: %v", err)
+	}
+}
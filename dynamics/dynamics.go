@@ -0,0 +1,130 @@
+// Package dynamics converts the world-frame motion of the car to its body frame.
+//
+// The body axes are the vehicle forward, left and up direction vectors, so
+// longitudinal values are positive forwards, lateral values positive to the
+// left and vertical values positive upwards. Angles are in radians.
+package dynamics
+
+import (
+	"math"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+type vec [3]float64
+
+func (a vec) dot(b vec) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func (a vec) cross(b vec) vec {
+	return vec{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func vec32(v [3]float32) vec {
+	return vec{float64(v[0]), float64(v[1]), float64(v[2])}
+}
+
+type Options struct {
+	// WorldUp is the world vertical. Default Y up.
+	WorldUp [3]float32
+	// WorldNorth is the horizontal world axis of zero heading. Default Z.
+	// Heading grows towards WorldUp × WorldNorth, X with the defaults.
+	WorldNorth [3]float32
+	// MinSpeed is the speed in m/s below which the slip angle is zero. Default 1.
+	MinSpeed float64
+}
+
+func (o *Options) defaults() {
+	if o.WorldUp == [3]float32{} {
+		o.WorldUp = [3]float32{0, 1, 0}
+	}
+	if o.WorldNorth == [3]float32{} {
+		o.WorldNorth = [3]float32{0, 0, 1}
+	}
+	if o.MinSpeed <= 0 {
+		o.MinSpeed = 1
+	}
+}
+
+// State holds the derived body-frame channels of one packet.
+type State struct {
+	StageTime float32 `json:"stage_time"`
+	Distance  float64 `json:"distance"`
+	// Velocities in m/s.
+	Longitudinal float64 `json:"velocity_longitudinal"`
+	Lateral      float64 `json:"velocity_lateral"`
+	Vertical     float64 `json:"velocity_vertical"`
+	// Accelerations in m/s².
+	AccelLongitudinal float64 `json:"acceleration_longitudinal"`
+	AccelLateral      float64 `json:"acceleration_lateral"`
+	AccelVertical     float64 `json:"acceleration_vertical"`
+	// Roll is positive with the left side up, Pitch with the nose up.
+	Roll    float64 `json:"roll"`
+	Pitch   float64 `json:"pitch"`
+	Heading float64 `json:"heading"`
+	// YawRate is the heading change in rad/s.
+	YawRate float64 `json:"yaw_rate"`
+	// SlipAngle is the angle from the nose to the velocity, positive to the left.
+	SlipAngle float64 `json:"slip_angle"`
+}
+
+type Tracker struct {
+	opts     Options
+	started  bool
+	gameTime float32
+	heading  float64
+}
+
+func New(opts Options) *Tracker {
+	opts.defaults()
+	return &Tracker{opts: opts}
+}
+
+// Update consumes a packet and returns its body-frame state. The yaw rate
+// needs the previous packet and is zero for the first one.
+func (t *Tracker) Update(p *packet.Packet) State {
+	o := &t.opts
+	fwd := vec{float64(p.VehicleForwardDirectionX), float64(p.VehicleForwardDirectionY), float64(p.VehicleForwardDirectionZ)}
+	left := vec{float64(p.VehicleLeftDirectionX), float64(p.VehicleLeftDirectionY), float64(p.VehicleLeftDirectionZ)}
+	up := vec{float64(p.VehicleUpDirectionX), float64(p.VehicleUpDirectionY), float64(p.VehicleUpDirectionZ)}
+	vel := vec{float64(p.VehicleVelocityX), float64(p.VehicleVelocityY), float64(p.VehicleVelocityZ)}
+	acc := vec{float64(p.VehicleAccelerationX), float64(p.VehicleAccelerationY), float64(p.VehicleAccelerationZ)}
+	wup, north := vec32(o.WorldUp), vec32(o.WorldNorth)
+	east := wup.cross(north)
+
+	s := State{
+		StageTime:         p.StageCurrentTime,
+		Distance:          p.StageCurrentDistance,
+		Longitudinal:      vel.dot(fwd),
+		Lateral:           vel.dot(left),
+		Vertical:          vel.dot(up),
+		AccelLongitudinal: acc.dot(fwd),
+		AccelLateral:      acc.dot(left),
+		AccelVertical:     acc.dot(up),
+		Roll:              math.Atan2(left.dot(wup), up.dot(wup)),
+		Pitch:             math.Asin(max(-1, min(1, fwd.dot(wup)))),
+		Heading:           math.Atan2(fwd.dot(east), fwd.dot(north)),
+	}
+	if math.Hypot(s.Longitudinal, s.Lateral) >= o.MinSpeed {
+		s.SlipAngle = math.Atan2(s.Lateral, s.Longitudinal)
+	}
+	if t.started {
+		if dt := float64(p.Elapsed(t.gameTime)); dt > 0 {
+			d := math.Remainder(s.Heading-t.heading, 2*math.Pi)
+			s.YawRate = d / dt
+		}
+	}
+	t.started, t.gameTime, t.heading = true, p.GameTotalTime, s.Heading
+	return s
+}
+
+// Channels returns the body-frame state of every packet.
+func Channels(packets []*packet.Packet, opts Options) []State {
+	t := New(opts)
+	states := make([]State, 0, len(packets))
+	for _, p := range packets {
+		states = append(states, t.Update(p))
+	}
+	return states
+}
@@ -0,0 +1,98 @@
+package dynamics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// heading returns an upright packet at game time t facing h radians from
+// Z towards X.
+func heading(t, h float64) *packet.Packet {
+	p := packet.New()
+	p.GameTotalTime = float32(t)
+	p.GameDeltaTime = 1.0 / 60
+	p.VehicleForwardDirectionX, p.VehicleForwardDirectionZ = float32(math.Sin(h)), float32(math.Cos(h))
+	p.VehicleLeftDirectionX, p.VehicleLeftDirectionZ = float32(-math.Cos(h)), float32(math.Sin(h))
+	p.VehicleUpDirectionY = 1
+	return p
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-5
+}
+
+func TestBodyFrame(t *testing.T) {
+	p := heading(0, 0)
+	// sliding to the left while braking
+	p.VehicleVelocityX, p.VehicleVelocityZ = -3, 20
+	p.VehicleAccelerationY, p.VehicleAccelerationZ = 9.8, -5
+	s := New(Options{}).Update(p)
+	if !near(s.Longitudinal, 20) || !near(s.Lateral, 3) || !near(s.Vertical, 0) {
+		t.Errorf("velocity %v %v %v", s.Longitudinal, s.Lateral, s.Vertical)
+	}
+	if !near(s.AccelLongitudinal, -5) || !near(s.AccelLateral, 0) || !near(s.AccelVertical, 9.8) {
+		t.Errorf("acceleration %v %v %v", s.AccelLongitudinal, s.AccelLateral, s.AccelVertical)
+	}
+	if !near(s.SlipAngle, math.Atan2(3, 20)) || s.YawRate != 0 {
+		t.Errorf("slip angle %v, yaw rate %v", s.SlipAngle, s.YawRate)
+	}
+	p.VehicleVelocityX, p.VehicleVelocityZ = 0.5, 0.5
+	if s := New(Options{}).Update(p); s.SlipAngle != 0 {
+		t.Errorf("slip angle %v below the minimum speed", s.SlipAngle)
+	}
+}
+
+func TestAttitude(t *testing.T) {
+	a := 10 * math.Pi / 180
+	nose := heading(0, 0)
+	nose.VehicleForwardDirectionY, nose.VehicleForwardDirectionZ = float32(math.Sin(a)), float32(math.Cos(a))
+	nose.VehicleUpDirectionY, nose.VehicleUpDirectionZ = float32(math.Cos(a)), float32(-math.Sin(a))
+	if s := New(Options{}).Update(nose); !near(s.Pitch, a) || !near(s.Roll, 0) {
+		t.Errorf("nose up pitch %v roll %v", s.Pitch, s.Roll)
+	}
+	side := heading(0, 0)
+	side.VehicleLeftDirectionX, side.VehicleLeftDirectionY = float32(-math.Cos(a)), float32(math.Sin(a))
+	side.VehicleUpDirectionX, side.VehicleUpDirectionY = float32(math.Sin(a)), float32(math.Cos(a))
+	if s := New(Options{}).Update(side); !near(s.Roll, a) || !near(s.Pitch, 0) {
+		t.Errorf("left side up roll %v pitch %v", s.Roll, s.Pitch)
+	}
+	// with Z up, north along Y
+	p := packet.New()
+	p.VehicleForwardDirectionX = 1
+	p.VehicleUpDirectionZ = 1
+	p.VehicleLeftDirectionY = 1
+	s := New(Options{WorldUp: [3]float32{0, 0, 1}, WorldNorth: [3]float32{0, 1, 0}}).Update(p)
+	if !near(s.Heading, -math.Pi/2) || !near(s.Roll, 0) || !near(s.Pitch, 0) {
+		t.Errorf("heading %v roll %v pitch %v", s.Heading, s.Roll, s.Pitch)
+	}
+}
+
+func TestYawRate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		from *packet.Packet
+		to   *packet.Packet
+		rate float64
+		h    float64
+	}{
+		{"turning right", heading(0, 0), heading(0.1, 0.1), 1, 0.1},
+		{"across south", heading(0, 3.1), heading(0.1, -3.1), (2*math.Pi - 6.2) / 0.1, -3.1},
+		{"same game time", heading(1, 0), heading(1, -0.01), -0.6, -0.01},
+	} {
+		tr := New(Options{})
+		tr.Update(tc.from)
+		s := tr.Update(tc.to)
+		if !near(s.Heading, tc.h) || math.Abs(s.YawRate-tc.rate) > 1e-3 {
+			t.Errorf("%s: heading %v yaw rate %v, want %v and %v", tc.name, s.Heading, s.YawRate, tc.h, tc.rate)
+		}
+	}
+	tr := New(Options{})
+	tr.Update(heading(1, 0))
+	paused := heading(1, 0.5)
+	paused.GameDeltaTime = 0
+	if s := tr.Update(paused); s.YawRate != 0 {
+		t.Errorf("yaw rate %v while paused", s.YawRate)
+	}
+}
@@ -0,0 +1,232 @@
+// Package impact detects impacts, rollovers and sudden speed losses for incident review.
+package impact
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// G is the standard gravity in m/s².
+const G = 9.80665
+
+type Kind int
+
+const (
+	Impact Kind = iota
+	Rollover
+	SpeedLoss
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Impact:
+		return "impact"
+	case Rollover:
+		return "rollover"
+	case SpeedLoss:
+		return "speed loss"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+type Severity int
+
+const (
+	Minor Severity = iota
+	Moderate
+	Severe
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Minor:
+		return "minor"
+	case Moderate:
+		return "moderate"
+	case Severe:
+		return "severe"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Event is an incident. It is reported when it is over, the times and
+// position are those of its start.
+type Event struct {
+	Kind      Kind     `json:"kind"`
+	Severity  Severity `json:"severity"`
+	StageTime float32  `json:"stage_time"`
+	Distance  float64  `json:"distance"`
+	X         float32  `json:"x"`
+	Y         float32  `json:"y"`
+	Z         float32  `json:"z"`
+	Duration  float32  `json:"duration"`
+	// PeakG is the largest acceleration in g.
+	PeakG float32 `json:"peak_g"`
+	// SpeedLoss is the speed lost in m/s.
+	SpeedLoss float32 `json:"speed_loss"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%v %v at %.0fm %.3fs peak %.1fg lost %.1fm/s", e.Severity, e.Kind, e.Distance, e.StageTime, e.PeakG, e.SpeedLoss)
+}
+
+type Options struct {
+	// ImpactG is the acceleration in g that starts an impact. Default 4.
+	// Impacts are Moderate from twice and Severe from three times this value.
+	ImpactG float32
+	// WorldUp is the world vertical. Default Y up.
+	WorldUp [3]float32
+	// RollCos is the cosine between the vehicle up and WorldUp below which
+	// the car counts as rolled. Default 0, on its side or beyond.
+	RollCos float32
+	// SpeedLoss is the speed drop in m/s within SpeedLossWindow seconds
+	// that is reported. Default 10 in 0.5.
+	// Losses are Moderate from twice and Severe from three times this value.
+	SpeedLoss       float32
+	SpeedLossWindow float32
+}
+
+func (o *Options) defaults() {
+	if o.ImpactG <= 0 {
+		o.ImpactG = 4
+	}
+	if o.WorldUp == [3]float32{} {
+		o.WorldUp = [3]float32{0, 1, 0}
+	}
+	if o.SpeedLoss <= 0 {
+		o.SpeedLoss = 10
+	}
+	if o.SpeedLossWindow <= 0 {
+		o.SpeedLossWindow = 0.5
+	}
+}
+
+func classify(v, threshold float32) Severity {
+	switch {
+	case v >= 3*threshold:
+		return Severe
+	case v >= 2*threshold:
+		return Moderate
+	}
+	return Minor
+}
+
+type sample struct {
+	time  float32
+	speed float32
+}
+
+type Detector struct {
+	opts    Options
+	impact  *Event
+	roll    *Event
+	loss    *Event
+	history []sample
+}
+
+func New(opts Options) *Detector {
+	opts.defaults()
+	return &Detector{opts: opts}
+}
+
+func start(kind Kind, p *packet.Packet) *Event {
+	return &Event{
+		Kind:      kind,
+		StageTime: p.StageCurrentTime,
+		Distance:  p.StageCurrentDistance,
+		X:         p.VehiclePositionX,
+		Y:         p.VehiclePositionY,
+		Z:         p.VehiclePositionZ,
+	}
+}
+
+// Update consumes a packet and returns the incidents that ended with it.
+func (d *Detector) Update(p *packet.Packet) []Event {
+	o := &d.opts
+	events := []Event{}
+	ax, ay, az := float64(p.VehicleAccelerationX), float64(p.VehicleAccelerationY), float64(p.VehicleAccelerationZ)
+	g := float32(math.Sqrt(ax*ax+ay*ay+az*az) / G)
+	if g >= o.ImpactG {
+		if d.impact == nil {
+			d.impact = start(Impact, p)
+		}
+		d.impact.PeakG = max(d.impact.PeakG, g)
+		d.impact.Duration = p.StageCurrentTime - d.impact.StageTime
+	} else if d.impact != nil {
+		d.impact.Severity = classify(d.impact.PeakG, o.ImpactG)
+		events = append(events, *d.impact)
+		d.impact = nil
+	}
+
+	up := p.VehicleUpDirectionX*o.WorldUp[0] + p.VehicleUpDirectionY*o.WorldUp[1] + p.VehicleUpDirectionZ*o.WorldUp[2]
+	if up < o.RollCos {
+		if d.roll == nil {
+			d.roll = start(Rollover, p)
+			d.roll.Severity = Severe
+		}
+		d.roll.PeakG = max(d.roll.PeakG, g)
+		d.roll.Duration = p.StageCurrentTime - d.roll.StageTime
+	} else if d.roll != nil {
+		events = append(events, *d.roll)
+		d.roll = nil
+	}
+
+	now := p.GameTotalTime
+	// the game clock goes back at a restart or rewind, the speeds before it
+	// are from another run
+	if n := len(d.history); n > 0 && now < d.history[n-1].time {
+		d.history = d.history[:0]
+	}
+	d.history = append(d.history, sample{time: now, speed: p.VehicleSpeed})
+	for len(d.history) > 1 && now-d.history[0].time > o.SpeedLossWindow {
+		d.history = d.history[1:]
+	}
+	top := float32(0)
+	for _, s := range d.history {
+		top = max(top, s.speed)
+	}
+	lost := top - p.VehicleSpeed
+	if lost >= o.SpeedLoss {
+		if d.loss == nil {
+			d.loss = start(SpeedLoss, p)
+		}
+		d.loss.SpeedLoss = max(d.loss.SpeedLoss, lost)
+		d.loss.PeakG = max(d.loss.PeakG, g)
+		d.loss.Duration = p.StageCurrentTime - d.loss.StageTime
+	} else if d.loss != nil {
+		d.loss.Severity = classify(d.loss.SpeedLoss, o.SpeedLoss)
+		events = append(events, *d.loss)
+		d.loss = nil
+	}
+	return events
+}
+
+// Flush returns the incidents still in progress.
+func (d *Detector) Flush() []Event {
+	events := []Event{}
+	if d.impact != nil {
+		d.impact.Severity = classify(d.impact.PeakG, d.opts.ImpactG)
+		events = append(events, *d.impact)
+	}
+	if d.roll != nil {
+		events = append(events, *d.roll)
+	}
+	if d.loss != nil {
+		d.loss.Severity = classify(d.loss.SpeedLoss, d.opts.SpeedLoss)
+		events = append(events, *d.loss)
+	}
+	d.impact, d.roll, d.loss = nil, nil, nil
+	return events
+}
+
+// Run returns the incidents of a run.
+func Run(packets []*packet.Packet, opts Options) []Event {
+	d := New(opts)
+	events := []Event{}
+	for _, p := range packets {
+		events = append(events, d.Update(p)...)
+	}
+	return append(events, d.Flush()...)
+}
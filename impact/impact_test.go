@@ -0,0 +1,115 @@
+package impact
+
+import (
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// drive returns packets 0.1s apart upright at the speeds, with the
+// accelerations in g along X.
+func drive(speeds, gs []float32) []*packet.Packet {
+	packets := []*packet.Packet{}
+	for i, v := range speeds {
+		p := packet.New()
+		p.GameTotalTime = float32(i) / 10
+		p.StageCurrentTime = p.GameTotalTime
+		p.StageCurrentDistance = float64(i)
+		p.VehicleSpeed = v
+		p.VehicleUpDirectionY = 1
+		if gs != nil {
+			p.VehicleAccelerationX = gs[i] * G
+		}
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func constant(v float32, n int) []float32 {
+	s := make([]float32, n)
+	for i := range s {
+		s[i] = v
+	}
+	return s
+}
+
+func TestImpact(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		gs       []float32
+		want     int
+		severity Severity
+		duration float32
+	}{
+		{"below the threshold", []float32{0, 3.9, 3.9, 0}, 0, 0, 0},
+		{"minor", []float32{0, 4, 5, 0}, 1, Minor, 0.1},
+		{"moderate", []float32{0, 9, 0}, 1, Moderate, 0},
+		{"severe", []float32{0, 5, 12, 6, 0}, 1, Severe, 0.2},
+		{"two", []float32{0, 5, 0, 5, 0}, 2, Minor, 0},
+		{"still going at the end", []float32{0, 0, 5}, 1, Minor, 0},
+	} {
+		events := Run(drive(constant(20, len(tc.gs)), tc.gs), Options{})
+		if len(events) != tc.want {
+			t.Errorf("%s: events %v", tc.name, events)
+			continue
+		}
+		if tc.want == 0 {
+			continue
+		}
+		e := events[0]
+		if e.Kind != Impact || e.Severity != tc.severity || e.Duration-tc.duration > 1e-5 || tc.duration-e.Duration > 1e-5 {
+			t.Errorf("%s: %+v", tc.name, e)
+		}
+	}
+}
+
+func TestRollover(t *testing.T) {
+	packets := drive(constant(10, 6), nil)
+	for _, p := range packets[2:4] {
+		p.VehicleUpDirectionY, p.VehicleUpDirectionX = -0.1, 1
+	}
+	events := Run(packets, Options{})
+	if len(events) != 1 || events[0].Kind != Rollover || events[0].Severity != Severe || events[0].Distance != 2 {
+		t.Errorf("events %v, want a rollover at 2m", events)
+	}
+	// on its side is not rolled with a stricter limit
+	packets[2].VehicleUpDirectionY, packets[3].VehicleUpDirectionY = 0.1, 0.1
+	if events := Run(packets, Options{}); len(events) != 0 {
+		t.Errorf("events %v on two wheels", events)
+	}
+	if events := Run(packets, Options{RollCos: 0.5}); len(events) != 1 {
+		t.Errorf("events %v, want a rollover below cos 0.5", events)
+	}
+}
+
+func TestSpeedLoss(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		speeds   []float32
+		want     int
+		severity Severity
+		lost     float32
+	}{
+		{"braking", []float32{30, 28.5, 27, 25.5, 24, 22.5, 21, 19.5, 18}, 0, 0, 0},
+		{"minor", []float32{30, 30, 18, 18, 18, 18, 18, 18, 18}, 1, Minor, 12},
+		{"severe", []float32{30, 30, 0, 0, 0, 0, 0, 0, 0}, 1, Severe, 30},
+	} {
+		events := Run(drive(tc.speeds, nil), Options{})
+		if len(events) != tc.want {
+			t.Errorf("%s: events %v", tc.name, events)
+			continue
+		}
+		if tc.want > 0 && (events[0].Kind != SpeedLoss || events[0].Severity != tc.severity || events[0].SpeedLoss != tc.lost || events[0].Distance != 2) {
+			t.Errorf("%s: %+v", tc.name, events[0])
+		}
+	}
+}
+
+func TestRewind(t *testing.T) {
+	// a restart at standstill is not a loss of the speed before it
+	fast := drive(constant(30, 5), nil)
+	restart := drive(constant(0, 5), nil)
+	if events := Run(append(fast, restart...), Options{}); len(events) != 0 {
+		t.Errorf("events %v across a restart", events)
+	}
+}
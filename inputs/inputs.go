@@ -0,0 +1,195 @@
+// Package inputs measures how the driver uses throttle, brake, clutch, steering and handbrake.
+package inputs
+
+import (
+	"math"
+
+	"github.com/nobonobo/easportswrc/packet"
+	"github.com/nobonobo/easportswrc/segment"
+)
+
+type Options struct {
+	// Threshold is the pedal position above which a pedal counts as pressed. Default 0.05.
+	Threshold float32
+	// FullThrottle is the throttle position counted as flat out. Default 0.98.
+	FullThrottle float32
+	// Reversal is how far the steering must travel back from its last extreme
+	// to count as a reversal. Default 0.05.
+	Reversal float32
+	// KickDuration is the longest clutch press counted as a clutch kick
+	// when made with the throttle pressed, in seconds. Default 0.3.
+	KickDuration float32
+}
+
+func (o *Options) defaults() {
+	if o.Threshold <= 0 {
+		o.Threshold = 0.05
+	}
+	if o.FullThrottle <= 0 {
+		o.FullThrottle = 0.98
+	}
+	if o.Reversal <= 0 {
+		o.Reversal = 0.05
+	}
+	if o.KickDuration <= 0 {
+		o.KickDuration = 0.3
+	}
+}
+
+// Metrics are the input statistics over a stretch of driving. Times are in seconds,
+// percentages are of Time.
+type Metrics struct {
+	Time            float64 `json:"time"`
+	AvgThrottle     float64 `json:"avg_throttle"`
+	AvgBrake        float64 `json:"avg_brake"`
+	FullThrottle    float64 `json:"full_throttle"`
+	FullThrottlePct float64 `json:"full_throttle_pct"`
+	Overlap         float64 `json:"overlap"`
+	OverlapPct      float64 `json:"overlap_pct"`
+	Coasting        float64 `json:"coasting"`
+	CoastingPct     float64 `json:"coasting_pct"`
+	SteeringRate    float64 `json:"steering_rate"` // mean absolute steering speed per second, lower is smoother
+	Reversals       int     `json:"reversals"`
+	ReversalsPerMin float64 `json:"reversals_per_min"`
+	HandbrakeUses   int     `json:"handbrake_uses"`
+	HandbrakeTime   float64 `json:"handbrake_time"`
+	ClutchKicks     int     `json:"clutch_kicks"`
+
+	throttle, brake float64
+	steeringTravel  float64
+}
+
+func (m *Metrics) finish() {
+	if m.Time <= 0 {
+		return
+	}
+	m.AvgThrottle = m.throttle / m.Time
+	m.AvgBrake = m.brake / m.Time
+	m.FullThrottlePct = 100 * m.FullThrottle / m.Time
+	m.OverlapPct = 100 * m.Overlap / m.Time
+	m.CoastingPct = 100 * m.Coasting / m.Time
+	m.SteeringRate = m.steeringTravel / m.Time
+	m.ReversalsPerMin = float64(m.Reversals) * 60 / m.Time
+}
+
+// Analyzer accumulates Metrics packet by packet.
+type Analyzer struct {
+	opts      Options
+	m         Metrics
+	started   bool
+	gameTime  float32
+	steering  float32
+	extreme   float32
+	direction int
+	handbrake bool
+	clutch    bool
+	clutchAt  float32
+	kick      bool
+}
+
+func New(opts Options) *Analyzer {
+	opts.defaults()
+	return &Analyzer{opts: opts}
+}
+
+func (a *Analyzer) Update(p *packet.Packet) {
+	started, gameTime, steering := a.started, a.gameTime, a.steering
+	a.started, a.gameTime, a.steering = true, p.GameTotalTime, p.VehicleSteering
+	if !started {
+		a.extreme = p.VehicleSteering
+		return
+	}
+	o, m := &a.opts, &a.m
+	d := float64(p.Elapsed(gameTime))
+	m.Time += d
+	m.throttle += float64(p.VehicleThrottle) * d
+	m.brake += float64(p.VehicleBrake) * d
+	throttle, brake := p.VehicleThrottle > o.Threshold, p.VehicleBrake > o.Threshold
+	if p.VehicleThrottle >= o.FullThrottle {
+		m.FullThrottle += d
+	}
+	if throttle && brake {
+		m.Overlap += d
+	}
+	if !throttle && !brake {
+		m.Coasting += d
+	}
+	m.steeringTravel += math.Abs(float64(p.VehicleSteering - steering))
+	s := p.VehicleSteering
+	switch {
+	case a.direction == 0:
+		if s-a.extreme >= o.Reversal {
+			a.direction, a.extreme = 1, s
+		} else if a.extreme-s >= o.Reversal {
+			a.direction, a.extreme = -1, s
+		}
+	case a.direction > 0:
+		if s > a.extreme {
+			a.extreme = s
+		} else if a.extreme-s >= o.Reversal {
+			m.Reversals++
+			a.direction, a.extreme = -1, s
+		}
+	default:
+		if s < a.extreme {
+			a.extreme = s
+		} else if s-a.extreme >= o.Reversal {
+			m.Reversals++
+			a.direction, a.extreme = 1, s
+		}
+	}
+	handbrake := p.VehicleHandbrake > o.Threshold
+	if handbrake {
+		m.HandbrakeTime += d
+		if !a.handbrake {
+			m.HandbrakeUses++
+		}
+	}
+	a.handbrake = handbrake
+	clutch := p.VehicleClutch > 0.5
+	if clutch && !a.clutch {
+		a.clutchAt = p.GameTotalTime
+		a.kick = throttle
+	}
+	if clutch && !throttle {
+		a.kick = false
+	}
+	if !clutch && a.clutch && a.kick && p.GameTotalTime-a.clutchAt <= o.KickDuration {
+		m.ClutchKicks++
+	}
+	a.clutch = clutch
+}
+
+// Metrics returns the statistics so far.
+func (a *Analyzer) Metrics() Metrics {
+	m := a.m
+	m.finish()
+	return m
+}
+
+// Run returns the statistics of a run.
+func Run(packets []*packet.Packet, opts Options) Metrics {
+	a := New(opts)
+	for _, p := range packets {
+		a.Update(p)
+	}
+	return a.Metrics()
+}
+
+// BySegment returns the statistics of a run for every segment of seg.
+func BySegment(packets []*packet.Packet, seg *segment.Segmentation, opts Options) []Metrics {
+	analyzers := make([]*Analyzer, len(seg.Segments))
+	for i := range analyzers {
+		analyzers[i] = New(opts)
+	}
+	for i, idx := range seg.Assign(packets) {
+		if idx >= 0 {
+			analyzers[idx].Update(packets[i])
+		}
+	}
+	res := make([]Metrics, len(analyzers))
+	for i, a := range analyzers {
+		res[i] = a.Metrics()
+	}
+	return res
+}
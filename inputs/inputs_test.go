@@ -0,0 +1,102 @@
+package inputs
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// frames returns n packets 0.1s apart set up by f.
+func frames(n int, f func(i int, p *packet.Packet)) []*packet.Packet {
+	packets := []*packet.Packet{}
+	for i := 0; i < n; i++ {
+		p := packet.New()
+		p.GameTotalTime = float32(i) / 10
+		p.GameDeltaTime = 1.0 / 60
+		f(i, p)
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
+
+func TestPedals(t *testing.T) {
+	m := Run(frames(30, func(i int, p *packet.Packet) {
+		switch {
+		case i < 10:
+			p.VehicleThrottle = 1
+		case i < 20:
+			p.VehicleThrottle, p.VehicleBrake = 0.5, 0.5
+		case i < 25:
+			// below the threshold counts as released
+			p.VehicleThrottle, p.VehicleBrake = 0.04, 0.04
+		}
+	}), Options{})
+	// the first packet only starts the clock
+	if !near(m.Time, 2.9) || !near(m.FullThrottle, 0.9) || !near(m.Overlap, 1) || !near(m.Coasting, 1) {
+		t.Errorf("time %v, full throttle %v, overlap %v, coasting %v", m.Time, m.FullThrottle, m.Overlap, m.Coasting)
+	}
+	if !near(m.FullThrottlePct, 100*0.9/2.9) || !near(m.AvgThrottle, (0.9+0.5+0.02)/2.9) || !near(m.AvgBrake, (0.5+0.02)/2.9) {
+		t.Errorf("full throttle %v%%, average throttle %v, brake %v", m.FullThrottlePct, m.AvgThrottle, m.AvgBrake)
+	}
+}
+
+func TestSteering(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		steering []float32
+		want     int
+	}{
+		{"left right left", []float32{0, 0.2, 0.4, 0.2, 0, -0.2, 0, 0.2}, 2},
+		{"wobble under the reversal", []float32{0, 0.03, 0, 0.03, 0, 0.03}, 0},
+		{"one way", []float32{0, -0.1, -0.3, -0.5, -0.5}, 0},
+	} {
+		m := Run(frames(len(tc.steering), func(i int, p *packet.Packet) {
+			p.VehicleSteering = tc.steering[i]
+		}), Options{})
+		if m.Reversals != tc.want {
+			t.Errorf("%s: %d reversals, want %d", tc.name, m.Reversals, tc.want)
+		}
+	}
+	m := Run(frames(11, func(i int, p *packet.Packet) {
+		p.VehicleSteering = float32(i%2) / 2
+	}), Options{})
+	if !near(m.SteeringRate, 5) || m.Reversals != 9 || !near(m.ReversalsPerMin, 9*60) {
+		t.Errorf("steering rate %v, %d reversals, %v a minute", m.SteeringRate, m.Reversals, m.ReversalsPerMin)
+	}
+}
+
+func TestHandbrakeAndClutch(t *testing.T) {
+	m := Run(frames(30, func(i int, p *packet.Packet) {
+		if i >= 5 && i < 8 || i >= 12 && i < 14 {
+			p.VehicleHandbrake = 1
+		}
+		if i < 20 {
+			p.VehicleThrottle = 1
+		}
+		// a kick, a clutch held too long and a clutch without throttle
+		if i >= 5 && i < 7 || i >= 10 && i < 16 || i >= 22 && i < 24 {
+			p.VehicleClutch = 1
+		}
+	}), Options{})
+	if m.HandbrakeUses != 2 || !near(m.HandbrakeTime, 0.5) {
+		t.Errorf("handbrake used %d times for %v", m.HandbrakeUses, m.HandbrakeTime)
+	}
+	if m.ClutchKicks != 1 {
+		t.Errorf("%d clutch kicks, want 1", m.ClutchKicks)
+	}
+}
+
+func TestStalledClock(t *testing.T) {
+	// repeated game times fall back to the frame time
+	m := Run(frames(4, func(i int, p *packet.Packet) {
+		p.GameTotalTime = 1
+	}), Options{})
+	if !near(m.Time, 3.0/60) {
+		t.Errorf("time %v, want 3 frames", m.Time)
+	}
+}
@@ -0,0 +1,140 @@
+// Package jsonl streams telemetry packets as JSON Lines keyed by channel ID.
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// TimeKey holds the receive time in RFC 3339 format.
+const TimeKey = "time"
+
+const nameSuffix = "_name"
+
+type Writer struct {
+	// Fields selects the keys in order. Default is Packet.Fields().
+	Fields []string
+	// Names adds a "<id>_name" key with the resolved name after each ID channel.
+	Names bool
+
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func quote(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+// Write writes p as one line. A zero t omits the time key.
+// uint64 channels, 4CCs and non finite floats are written as strings to survive
+// jq, 4CCs that are not printable ASCII as 0x and 8 hex digits.
+func (w *Writer) Write(t time.Time, p *packet.Packet) error {
+	fields := w.Fields
+	if len(fields) == 0 {
+		fields = p.Fields()
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('{')
+	if !t.IsZero() {
+		quote(buf, TimeKey)
+		buf.WriteByte(':')
+		quote(buf, t.Format(time.RFC3339Nano))
+		buf.WriteByte(',')
+	}
+	for i, key := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		v, err := p.Value(key)
+		if err != nil {
+			return err
+		}
+		s, err := p.FormatValue(key)
+		if err != nil {
+			return err
+		}
+		quote(buf, key)
+		buf.WriteByte(':')
+		switch v := v.(type) {
+		case [4]byte, uint64:
+			quote(buf, s)
+		case float32:
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				quote(buf, s)
+			} else {
+				buf.WriteString(s)
+			}
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				quote(buf, s)
+			} else {
+				buf.WriteString(s)
+			}
+		default:
+			buf.WriteString(s)
+		}
+		if name, ok := p.Name(key); ok && w.Names {
+			buf.WriteByte(',')
+			quote(buf, key+nameSuffix)
+			buf.WriteByte(':')
+			quote(buf, name)
+		}
+	}
+	buf.WriteString("}\n")
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+type Reader struct {
+	d *json.Decoder
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{d: json.NewDecoder(r)}
+}
+
+// Read returns the next packet and its receive time, zero if absent.
+// Unknown keys such as names are ignored.
+func (r *Reader) Read() (time.Time, *packet.Packet, error) {
+	var obj map[string]json.RawMessage
+	if err := r.d.Decode(&obj); err != nil {
+		return time.Time{}, nil, err
+	}
+	var t time.Time
+	if raw, ok := obj[TimeKey]; ok {
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return time.Time{}, nil, err
+		}
+	}
+	p := packet.New()
+	for key, raw := range obj {
+		if _, ok := packet.ChannelDicts[key]; !ok {
+			continue
+		}
+		s := string(raw)
+		if len(raw) > 0 && raw[0] == '"' {
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return time.Time{}, nil, fmt.Errorf("field %s: %w", key, err)
+			}
+		}
+		if err := p.ParseValue(key, s); err != nil {
+			return time.Time{}, nil, err
+		}
+	}
+	return t, p, nil
+}
@@ -0,0 +1,79 @@
+package jsonl
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// diff returns the first channel whose binary value differs.
+func diff(a, b *packet.Packet) string {
+	for _, key := range a.Fields() {
+		x, _ := a.Value(key)
+		y, _ := b.Value(key)
+		if fmt.Sprintf("%#v", x) != fmt.Sprintf("%#v", y) {
+			return fmt.Sprintf("%s %#v, want %#v", key, y, x)
+		}
+	}
+	return "packets differ"
+}
+
+func TestRoundTrip(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	packets := []*packet.Packet{}
+	for _, fourcc := range [][4]byte{
+		{'s', 'e', 's', 'u'},
+		{},
+		{0xff, 0, 'a', 0x80},
+		{'0', 'x', '1', '2'},
+		{'a', 'b', 0, 0},
+		{'a', 0, 'b', 0},
+	} {
+		p := packet.New()
+		p.Packet4CC = fourcc
+		p.PacketUID = math.MaxUint64
+		p.VehicleSpeed = float32(math.NaN())
+		p.VehicleSteering = float32(math.Inf(-1))
+		p.StageCurrentDistance = 1234.5678901234
+		p.StageShakedown = true
+		packets = append(packets, p)
+	}
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Names = true
+	for i, p := range packets {
+		ts := base.Add(time.Duration(i) * time.Millisecond)
+		if i == 1 {
+			ts = time.Time{}
+		}
+		if err := w.Write(ts, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(buf)
+	for i, want := range packets {
+		ts, got, err := r.Read()
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+		wantTime := base.Add(time.Duration(i) * time.Millisecond)
+		if i == 1 {
+			wantTime = time.Time{}
+		}
+		if !ts.Equal(wantTime) {
+			t.Errorf("packet %d: time %v, want %v", i, ts, wantTime)
+		}
+		a, _ := want.MarshalBinary()
+		b, _ := got.MarshalBinary()
+		if !bytes.Equal(a, b) {
+			t.Errorf("packet %d: %s", i, diff(want, got))
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package jumps detects jumps and measures their landings.
+package jumps
+
+import (
+	"math"
+	"sort"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// G is the standard gravity in m/s².
+const G = 9.80665
+
+type Options struct {
+	// FreeFall is the vertical acceleration in g at or below which the car
+	// is airborne, the acceleration channels do not include gravity. Default -0.6.
+	FreeFall float32
+	// MinAirtime is the shortest airtime in seconds reported as a jump. Default 0.15.
+	MinAirtime float32
+	// LandingWindow is the time in seconds after touch down searched
+	// for the landing acceleration. Default 0.3.
+	LandingWindow float32
+	// Inverted takes negative hub positions and velocities as compression,
+	// as in suspension.Options.
+	Inverted bool
+	// NoHubs ignores the hub channels and detects jumps by acceleration only.
+	// Otherwise every wheel must droop Droop below its ride height to confirm
+	// a take-off and one must be back within Droop of it to confirm the landing.
+	NoHubs bool
+	// Droop is the hub travel below the ride height of a hanging wheel. Default 0.01.
+	Droop float32
+	// WorldUp is the world vertical. Default Y up.
+	WorldUp [3]float32
+}
+
+func (o *Options) defaults() {
+	if o.FreeFall == 0 {
+		o.FreeFall = -0.6
+	}
+	if o.MinAirtime <= 0 {
+		o.MinAirtime = 0.15
+	}
+	if o.LandingWindow <= 0 {
+		o.LandingWindow = 0.3
+	}
+	if o.Droop <= 0 {
+		o.Droop = 0.01
+	}
+	if o.WorldUp == [3]float32{} {
+		o.WorldUp = [3]float32{0, 1, 0}
+	}
+}
+
+// Jump is one take-off and landing.
+type Jump struct {
+	RouteID         uint16  `json:"route_id"`
+	TakeOffTime     float32 `json:"take_off_time"`
+	TakeOffDistance float64 `json:"take_off_distance"`
+	TakeOffSpeed    float32 `json:"take_off_speed"`
+	LandingTime     float32 `json:"landing_time"`
+	LandingDistance float64 `json:"landing_distance"`
+	Airtime         float32 `json:"airtime"`
+	// LandingG is the largest vertical acceleration in g just after touch down.
+	LandingG float32 `json:"landing_g"`
+	// LandingPitch is the nose angle in degrees at touch down, positive nose up.
+	LandingPitch float32 `json:"landing_pitch"`
+}
+
+// rideTime is the time constant in seconds of the ride height average, and
+// the time on the ground before the hubs are used.
+const rideTime = 1
+
+// take-off values of the previous packet.
+type previous struct {
+	stageTime float32
+	distance  float64
+	speed     float32
+}
+
+type Detector struct {
+	opts     Options
+	air      *Jump
+	landing  *Jump
+	last     *previous
+	gameTime float32
+	ride     [4]float32 // hub position averaged on the ground
+	grounded float32    // time on the ground averaged into ride
+	fall     float32    // stage time of the last free fall
+}
+
+func New(opts Options) *Detector {
+	opts.defaults()
+	return &Detector{opts: opts}
+}
+
+func (d *Detector) vertical(x, y, z float32) float32 {
+	u := d.opts.WorldUp
+	return x*u[0] + y*u[1] + z*u[2]
+}
+
+func (d *Detector) hub(p *packet.Packet, pos packet.Position) float32 {
+	if d.opts.Inverted {
+		return -p.HubPosition(pos)
+	}
+	return p.HubPosition(pos)
+}
+
+// hubs reports whether the hub channels are used, once the ride height is known.
+func (d *Detector) hubs() bool {
+	return !d.opts.NoHubs && d.grounded >= rideTime
+}
+
+// drooping reports whether every wheel hangs below its ride height.
+func (d *Detector) drooping(p *packet.Packet) bool {
+	for i, pos := range packet.Positions {
+		if d.hub(p, pos) > d.ride[i]-d.opts.Droop {
+			return false
+		}
+	}
+	return true
+}
+
+// touching reports whether a wheel is back near its ride height.
+func (d *Detector) touching(p *packet.Packet) bool {
+	for i, pos := range packet.Positions {
+		if d.hub(p, pos) > d.ride[i]-d.opts.Droop {
+			return true
+		}
+	}
+	return false
+}
+
+// settle averages the hub positions on the ground into the ride height.
+func (d *Detector) settle(p *packet.Packet, dt float32) {
+	for i, pos := range packet.Positions {
+		x := d.hub(p, pos)
+		if d.grounded == 0 {
+			d.ride[i] = x
+		} else {
+			d.ride[i] += (x - d.ride[i]) * dt / (rideTime + dt)
+		}
+	}
+	d.grounded = min(d.grounded+dt, rideTime)
+}
+
+// Update consumes a packet and returns the jump whose landing was just measured.
+func (d *Detector) Update(p *packet.Packet) *Jump {
+	last := d.last
+	d.last = &previous{stageTime: p.StageCurrentTime, distance: p.StageCurrentDistance, speed: p.VehicleSpeed}
+	dt := float32(0)
+	if last != nil {
+		dt = p.Elapsed(d.gameTime)
+	}
+	d.gameTime = p.GameTotalTime
+	o := &d.opts
+	vg := d.vertical(p.VehicleAccelerationX, p.VehicleAccelerationY, p.VehicleAccelerationZ) / G
+	var done *Jump
+	if d.landing != nil {
+		if p.StageCurrentTime-d.landing.LandingTime <= o.LandingWindow {
+			d.landing.LandingG = max(d.landing.LandingG, vg)
+		} else {
+			done, d.landing = d.landing, nil
+		}
+	}
+	freeFall := vg <= o.FreeFall
+	if freeFall {
+		d.fall = p.StageCurrentTime
+	}
+	airborne := freeFall
+	if d.hubs() {
+		if d.air == nil {
+			airborne = freeFall && d.drooping(p)
+		} else {
+			// without a wheel at ride height it lands LandingWindow after the free fall
+			airborne = freeFall || !d.touching(p) && p.StageCurrentTime-d.fall <= o.LandingWindow
+		}
+	}
+	if !airborne && d.air == nil && !freeFall {
+		d.settle(p, dt)
+	}
+	switch {
+	case airborne && d.air == nil:
+		take := d.last
+		if last != nil {
+			take = last
+		}
+		d.air = &Jump{
+			RouteID:         p.RouteID,
+			TakeOffTime:     take.stageTime,
+			TakeOffDistance: take.distance,
+			TakeOffSpeed:    take.speed,
+		}
+	case !airborne && d.air != nil:
+		j := d.air
+		d.air = nil
+		j.LandingTime = p.StageCurrentTime
+		j.LandingDistance = p.StageCurrentDistance
+		j.Airtime = j.LandingTime - j.TakeOffTime
+		if j.Airtime < o.MinAirtime {
+			break
+		}
+		fv := d.vertical(p.VehicleForwardDirectionX, p.VehicleForwardDirectionY, p.VehicleForwardDirectionZ)
+		j.LandingPitch = float32(math.Asin(math.Max(-1, math.Min(1, float64(fv)))) * 180 / math.Pi)
+		j.LandingG = vg
+		if d.landing != nil {
+			done = d.landing
+		}
+		d.landing = j
+	}
+	return done
+}
+
+// Flush returns the jump whose landing is still being measured.
+func (d *Detector) Flush() *Jump {
+	j := d.landing
+	d.landing, d.air = nil, nil
+	return j
+}
+
+// Run returns the jumps of a run.
+func Run(packets []*packet.Packet, opts Options) []Jump {
+	d := New(opts)
+	jumps := []Jump{}
+	for _, p := range packets {
+		if j := d.Update(p); j != nil {
+			jumps = append(jumps, *j)
+		}
+	}
+	if j := d.Flush(); j != nil {
+		jumps = append(jumps, *j)
+	}
+	return jumps
+}
+
+// Site is a jump of a route aggregated over the runs.
+type Site struct {
+	RouteID         uint16  `json:"route_id"`
+	TakeOffDistance float64 `json:"take_off_distance"`
+	Count           int     `json:"count"`
+	AvgAirtime      float32 `json:"avg_airtime"`
+	MaxAirtime      float32 `json:"max_airtime"`
+	AvgLandingG     float32 `json:"avg_landing_g"`
+	MaxLandingG     float32 `json:"max_landing_g"`
+	AvgLandingPitch float32 `json:"avg_landing_pitch"`
+	AvgTakeOffSpeed float32 `json:"avg_take_off_speed"`
+	Jumps           []Jump  `json:"jumps"`
+}
+
+// Collection aggregates jumps per route, grouping take-offs close to each other.
+type Collection struct {
+	// Radius is the take-off distance in metres within which jumps are the same site. Default 20.
+	Radius float64
+
+	routes map[uint16][]*Site
+}
+
+func NewCollection() *Collection {
+	return &Collection{Radius: 20, routes: map[uint16][]*Site{}}
+}
+
+// Add adds the jumps of a run, each to the nearest site within Radius.
+func (c *Collection) Add(jumps []Jump) {
+	for _, j := range jumps {
+		var site *Site
+		nearest := c.Radius
+		for _, s := range c.routes[j.RouteID] {
+			if d := math.Abs(s.TakeOffDistance - j.TakeOffDistance); d <= nearest {
+				site, nearest = s, d
+			}
+		}
+		if site == nil {
+			site = &Site{RouteID: j.RouteID}
+			c.routes[j.RouteID] = append(c.routes[j.RouteID], site)
+		}
+		site.add(j)
+	}
+}
+
+func (s *Site) add(j Jump) {
+	s.Jumps = append(s.Jumps, j)
+	n := float32(len(s.Jumps))
+	s.Count = len(s.Jumps)
+	s.TakeOffDistance += (j.TakeOffDistance - s.TakeOffDistance) / float64(n)
+	s.AvgAirtime += (j.Airtime - s.AvgAirtime) / n
+	s.AvgLandingG += (j.LandingG - s.AvgLandingG) / n
+	s.AvgLandingPitch += (j.LandingPitch - s.AvgLandingPitch) / n
+	s.AvgTakeOffSpeed += (j.TakeOffSpeed - s.AvgTakeOffSpeed) / n
+	s.MaxAirtime = max(s.MaxAirtime, j.Airtime)
+	s.MaxLandingG = max(s.MaxLandingG, j.LandingG)
+}
+
+// Sites returns the jump sites of a route ordered by distance.
+func (c *Collection) Sites(routeID uint16) []*Site {
+	sites := append([]*Site(nil), c.routes[routeID]...)
+	sort.Slice(sites, func(i, j int) bool { return sites[i].TakeOffDistance < sites[j].TakeOffDistance })
+	return sites
+}
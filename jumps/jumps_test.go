@@ -0,0 +1,122 @@
+package jumps
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// phase is a stretch of frames with a vertical acceleration in g and
+// all hubs at one position.
+type phase struct {
+	frames int
+	g, hub float32
+}
+
+var (
+	ground  = phase{120, 0, 0.1}
+	landing = phase{1, 3, 0.12}
+)
+
+// drive returns packets at 60 Hz and 30 m/s through the phases.
+func drive(phases ...phase) []*packet.Packet {
+	packets := []*packet.Packet{}
+	for _, ph := range phases {
+		for i := 0; i < ph.frames; i++ {
+			n := len(packets)
+			p := packet.New()
+			p.RouteID = 7
+			p.GameTotalTime = float32(n) / 60
+			p.StageCurrentTime = p.GameTotalTime
+			p.StageCurrentDistance = float64(n) / 2
+			p.VehicleSpeed = 30
+			p.VehicleAccelerationY = ph.g * G
+			p.VehicleForwardDirectionZ = 1
+			p.VehicleHubPositionFl, p.VehicleHubPositionFr = ph.hub, ph.hub
+			p.VehicleHubPositionBl, p.VehicleHubPositionBr = ph.hub, ph.hub
+			packets = append(packets, p)
+		}
+	}
+	return packets
+}
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		packets []*packet.Packet
+		opts    Options
+		airtime float32
+	}{
+		{"jump", drive(ground, phase{30, -1, 0.05}, landing, ground), Options{}, 0.5},
+		{"too short", drive(ground, phase{6, -1, 0.05}, landing, ground), Options{}, 0},
+		// light over a crest with the wheels on the road
+		{"crest", drive(ground, phase{30, -1, 0.1}, landing, ground), Options{}, 0},
+		{"crest without hubs", drive(ground, phase{30, -1, 0.1}, landing, ground), Options{NoHubs: true}, 0.5},
+		{"before the ride height is known", drive(phase{30, 0, 0.1}, phase{30, -1, 0.1}, landing, ground), Options{}, 0.5},
+		{"inverted hubs", drive(ground, phase{30, -1, 0.15}, phase{1, 3, 0.1}, ground), Options{Inverted: true}, 0.5},
+		{"compressed hubs", drive(ground, phase{30, -1, 0.15}, phase{1, 3, 0.1}, ground), Options{}, 0},
+		{"landing at the end", drive(ground, phase{30, -1, 0.05}, landing), Options{}, 0.5},
+	} {
+		jumps := Run(tc.packets, tc.opts)
+		if tc.airtime == 0 {
+			if len(jumps) != 0 {
+				t.Errorf("%s: jumps %+v", tc.name, jumps)
+			}
+			continue
+		}
+		if len(jumps) != 1 {
+			t.Errorf("%s: jumps %+v, want 1", tc.name, jumps)
+			continue
+		}
+		j := jumps[0]
+		// taken off in the last packet on the ground
+		if math.Abs(float64(j.Airtime-tc.airtime-1.0/60)) > 1e-4 || j.LandingG != 3 || j.TakeOffSpeed != 30 || j.RouteID != 7 {
+			t.Errorf("%s: %+v", tc.name, j)
+		}
+		if j.LandingDistance-j.TakeOffDistance != 15.5 {
+			t.Errorf("%s: from %vm to %vm", tc.name, j.TakeOffDistance, j.LandingDistance)
+		}
+	}
+}
+
+func TestLanding(t *testing.T) {
+	packets := drive(ground, phase{30, -1, 0.05}, phase{1, 2, 0.12}, phase{5, 4, 0.1}, phase{15, 0, 0.1}, phase{30, 6, 0.1})
+	// nose down 10 degrees at touch down
+	touch := packets[150]
+	touch.VehicleForwardDirectionY = float32(math.Sin(-10 * math.Pi / 180))
+	touch.VehicleForwardDirectionZ = float32(math.Cos(-10 * math.Pi / 180))
+	jumps := Run(packets, Options{})
+	if len(jumps) != 1 {
+		t.Fatalf("jumps %+v", jumps)
+	}
+	// the hardest hit within the landing window, not the one after it
+	if j := jumps[0]; j.LandingG != 4 || math.Abs(float64(j.LandingPitch+10)) > 1e-3 {
+		t.Errorf("landing %v g pitch %v", j.LandingG, j.LandingPitch)
+	}
+}
+
+func TestCollection(t *testing.T) {
+	c := NewCollection()
+	c.Add([]Jump{
+		{RouteID: 7, TakeOffDistance: 100, Airtime: 1, LandingG: 2},
+		{RouteID: 7, TakeOffDistance: 130, Airtime: 0.5},
+		{RouteID: 8, TakeOffDistance: 100},
+	})
+	// within the radius of both, nearer the second
+	c.Add([]Jump{
+		{RouteID: 7, TakeOffDistance: 118, Airtime: 1.5},
+		{RouteID: 7, TakeOffDistance: 104, Airtime: 0.5, LandingG: 4},
+	})
+	sites := c.Sites(7)
+	if len(sites) != 2 || len(c.Sites(8)) != 1 || len(c.Sites(9)) != 0 {
+		t.Fatalf("sites %v", sites)
+	}
+	first, second := sites[0], sites[1]
+	if first.Count != 2 || first.TakeOffDistance != 102 || first.AvgAirtime != 0.75 || first.MaxLandingG != 4 || first.AvgLandingG != 3 {
+		t.Errorf("first site %+v", first)
+	}
+	if second.Count != 2 || second.TakeOffDistance != 124 || second.MaxAirtime != 1.5 {
+		t.Errorf("second site %+v", second)
+	}
+}
@@ -0,0 +1,367 @@
+// Package motec exports recorded telemetry as MoTeC i2 .ld log files.
+package motec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+var endian = binary.LittleEndian
+
+// ldHead is the file header at offset 0.
+type ldHead struct {
+	Marker        uint32
+	_             [4]byte
+	MetaPtr       uint32
+	DataPtr       uint32
+	_             [20]byte
+	EventPtr      uint32
+	_             [24]byte
+	Unknown1      uint16
+	Unknown2      uint16
+	Unknown3      uint16
+	DeviceSerial  uint32
+	DeviceType    [8]byte
+	DeviceVersion uint16
+	Unknown4      uint16
+	NumChannels   uint32
+	_             [4]byte
+	Date          [16]byte
+	_             [16]byte
+	Time          [16]byte
+	_             [16]byte
+	Driver        [64]byte
+	VehicleID     [64]byte
+	_             [64]byte
+	Venue         [64]byte
+	_             [64]byte
+	_             [1024]byte
+	ProLogging    uint32
+	_             [66]byte
+	ShortComment  [64]byte
+	_             [126]byte
+}
+
+type ldEvent struct {
+	Name     [64]byte
+	Session  [64]byte
+	Comment  [1024]byte
+	VenuePtr uint16
+}
+
+type ldVenue struct {
+	Name       [64]byte
+	_          [1034]byte
+	VehiclePtr uint16
+}
+
+type ldVehicle struct {
+	ID      [64]byte
+	_       [128]byte
+	Weight  uint32
+	Type    [32]byte
+	Comment [32]byte
+}
+
+// ldChan is one entry of the doubly linked channel list.
+type ldChan struct {
+	PrevPtr   uint32
+	NextPtr   uint32
+	DataPtr   uint32
+	DataLen   uint32
+	Counter   uint16
+	TypeA     uint16
+	Type      uint16
+	Freq      uint16
+	Shift     int16
+	Mul       int16
+	Scale     int16
+	Dec       int16
+	Name      [32]byte
+	ShortName [8]byte
+	Unit      [12]byte
+	_         [40]byte
+}
+
+// dataType returns the i2 data type and sample size in bytes of a channel
+// by its type in the channel definitions. The values are stored unscaled.
+func dataType(ch *packet.Channel) (typeA, size uint16, err error) {
+	switch ch.Type {
+	case "float32", "float64":
+		return 0x07, 4, nil
+	case "boolean", "uint8":
+		return 0x03, 2, nil
+	case "uint16":
+		return 0x05, 4, nil
+	}
+	return 0, 0, fmt.Errorf("channel %s of type %s can not be exported", ch.ID, ch.Type)
+}
+
+func putSample(buf *bytes.Buffer, typeA uint16, v float64) {
+	switch typeA {
+	case 0x07:
+		binary.Write(buf, endian, float32(v))
+	case 0x03:
+		binary.Write(buf, endian, int16(v))
+	default:
+		binary.Write(buf, endian, int32(v))
+	}
+}
+
+// LD is a recorded session to be written as a .ld file.
+type LD struct {
+	Driver  string
+	Session string
+	Comment string
+	// Date is the start of the session. Default is the time of writing.
+	Date time.Time
+	// Frequency is the sample rate in Hz. Default is estimated from the median
+	// GameTotalTime between packets.
+	Frequency int
+	// Rates overrides Frequency for single channels, for example a lower
+	// rate for the slowly changing brake temperatures.
+	Rates map[string]int
+	// Fields selects the channels. Default is every numeric channel of Packet.Fields().
+	Fields []string
+	// Packets is the session in arrival order.
+	Packets []*packet.Packet
+}
+
+func (ld *LD) frequency() int {
+	if ld.Frequency > 0 {
+		return ld.Frequency
+	}
+	gaps := []float64{}
+	for i := 1; i < len(ld.Packets); i++ {
+		if d := ld.Packets[i].GameTotalTime - ld.Packets[i-1].GameTotalTime; d > 0 {
+			gaps = append(gaps, float64(d))
+		}
+	}
+	if len(gaps) == 0 {
+		return 1
+	}
+	slices.Sort(gaps)
+	return max(1, int(math.Round(1/gaps[len(gaps)/2])))
+}
+
+func (ld *LD) fields() []string {
+	if len(ld.Fields) > 0 {
+		return ld.Fields
+	}
+	fields := []string{}
+	for _, key := range packet.New().Fields() {
+		if _, _, err := dataType(packet.ChannelDicts[key]); err != nil {
+			continue
+		}
+		fields = append(fields, key)
+	}
+	return fields
+}
+
+// samples resamples the packets onto a fixed rate grid, holding the last value.
+func (ld *LD) samples(freq int) []*packet.Packet {
+	if len(ld.Packets) == 0 {
+		return nil
+	}
+	t0 := float64(ld.Packets[0].GameTotalTime)
+	d := float64(ld.Packets[len(ld.Packets)-1].GameTotalTime) - t0
+	if d <= 0 {
+		return ld.Packets
+	}
+	n := int(d*float64(freq)) + 1
+	res := make([]*packet.Packet, 0, n)
+	j := 0
+	for i := 0; i < n; i++ {
+		t := t0 + float64(i)/float64(freq)
+		for j+1 < len(ld.Packets) && float64(ld.Packets[j+1].GameTotalTime) <= t {
+			j++
+		}
+		res = append(res, ld.Packets[j])
+	}
+	return res
+}
+
+func put(dst []byte, s string) {
+	copy(dst, s)
+}
+
+// shortNames abbreviates the channel keys to the 8 bytes of the short name
+// field, the initials of the words followed by the last word, numbered when
+// two keys abbreviate alike: vehicle_hub_position_fl becomes vhpfl.
+func shortNames(keys []string) []string {
+	names := make([]string, len(keys))
+	used := map[string]bool{}
+	for i, key := range keys {
+		words := strings.Split(key, "_")
+		name := ""
+		for _, w := range words[:len(words)-1] {
+			if w != "" {
+				name += w[:1]
+			}
+		}
+		name += words[len(words)-1]
+		if len(name) > 8 {
+			name = name[:8]
+		}
+		base := name
+		for n := 2; used[name]; n++ {
+			suffix := fmt.Sprint(n)
+			name = base[:min(len(base), 8-len(suffix))] + suffix
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+// WriteTo writes the .ld file. Event, venue and vehicle metadata come from
+// the first packet. The units are the ones of the channel definitions, cut
+// to the 12 bytes of the field.
+func (ld *LD) WriteTo(w io.Writer) (int64, error) {
+	if len(ld.Packets) == 0 {
+		return 0, fmt.Errorf("no packets")
+	}
+	first := ld.Packets[0]
+	fields := ld.fields()
+	freqs := make([]int, len(fields))
+	samples := map[int][]*packet.Packet{}
+	for i, key := range fields {
+		freq := ld.frequency()
+		if f, ok := ld.Rates[key]; ok {
+			freq = f
+		}
+		if freq <= 0 || freq > math.MaxUint16 {
+			return 0, fmt.Errorf("invalid frequency %d of %s", freq, key)
+		}
+		freqs[i] = freq
+		if _, ok := samples[freq]; !ok {
+			samples[freq] = ld.samples(freq)
+		}
+	}
+	date := ld.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	eventPtr := uint32(binary.Size(ldHead{}))
+	venuePtr := eventPtr + uint32(binary.Size(ldEvent{}))
+	vehiclePtr := venuePtr + uint32(binary.Size(ldVenue{}))
+	metaPtr := vehiclePtr + uint32(binary.Size(ldVehicle{}))
+	chanSize := uint32(binary.Size(ldChan{}))
+	dataPtr := metaPtr + chanSize*uint32(len(fields))
+
+	head := ldHead{
+		Marker:        0x40,
+		MetaPtr:       metaPtr,
+		DataPtr:       dataPtr,
+		EventPtr:      eventPtr,
+		Unknown1:      1,
+		Unknown2:      0x4240,
+		Unknown3:      0xf,
+		DeviceSerial:  0x1f44,
+		DeviceVersion: 420,
+		Unknown4:      0xadb0,
+		NumChannels:   uint32(len(fields)),
+		ProLogging:    0xc81a4,
+	}
+	put(head.DeviceType[:], "ADL")
+	put(head.Date[:], date.Format("02/01/2006"))
+	put(head.Time[:], date.Format("15:04:05"))
+	put(head.Driver[:], ld.Driver)
+	put(head.VehicleID[:], first.Vehicle())
+	put(head.Venue[:], first.Route())
+	put(head.ShortComment[:], ld.Comment)
+
+	event := ldEvent{VenuePtr: uint16(venuePtr)}
+	put(event.Name[:], first.Location())
+	session := ld.Session
+	if session == "" {
+		session = first.GameModeString()
+	}
+	put(event.Session[:], session)
+	put(event.Comment[:], ld.Comment)
+
+	venue := ldVenue{VehiclePtr: uint16(vehiclePtr)}
+	put(venue.Name[:], first.Route())
+
+	vehicle := ldVehicle{}
+	put(vehicle.ID[:], first.Vehicle())
+	put(vehicle.Type[:], first.VehicleClass())
+	put(vehicle.Comment[:], first.VehicleManufacturer())
+
+	buf := bytes.NewBuffer(nil)
+	for _, v := range []any{head, event, venue, vehicle} {
+		if err := binary.Write(buf, endian, v); err != nil {
+			return 0, err
+		}
+	}
+	short := shortNames(fields)
+	types := make([]uint16, len(fields))
+	ptr := dataPtr
+	for i, key := range fields {
+		channel, ok := packet.ChannelDicts[key]
+		if !ok {
+			return 0, fmt.Errorf("channel %s not found", key)
+		}
+		typeA, size, err := dataType(channel)
+		if err != nil {
+			return 0, err
+		}
+		types[i] = typeA
+		n := uint32(len(samples[freqs[i]]))
+		ch := ldChan{
+			DataPtr: ptr,
+			DataLen: n,
+			Counter: uint16(0x2ee1 + i),
+			TypeA:   typeA,
+			Type:    size,
+			Freq:    uint16(freqs[i]),
+			Mul:     1,
+			Scale:   1,
+		}
+		ptr += n * uint32(size)
+		if i > 0 {
+			ch.PrevPtr = metaPtr + chanSize*uint32(i-1)
+		}
+		if i < len(fields)-1 {
+			ch.NextPtr = metaPtr + chanSize*uint32(i+1)
+		}
+		put(ch.Name[:], key)
+		put(ch.ShortName[:], short[i])
+		put(ch.Unit[:], channel.Units)
+		if err := binary.Write(buf, endian, ch); err != nil {
+			return 0, err
+		}
+	}
+	for i, key := range fields {
+		for _, p := range samples[freqs[i]] {
+			v, err := p.Float(key)
+			if err != nil {
+				return 0, err
+			}
+			putSample(buf, types[i], v)
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+func WriteFile(filename string, ld *LD) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := ld.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
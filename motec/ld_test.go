@@ -0,0 +1,148 @@
+package motec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+func cstring(b []byte) string {
+	return strings.TrimRight(string(b), "\x00")
+}
+
+func at(t *testing.T, b []byte, off uint32, v any) {
+	t.Helper()
+	if int(off)+binary.Size(v) > len(b) {
+		t.Fatalf("%T at %d beyond the end %d", v, off, len(b))
+	}
+	if err := binary.Read(bytes.NewReader(b[off:]), endian, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	packets := []*packet.Packet{}
+	for i := 0; i < 121; i++ {
+		p := packet.New()
+		p.GameTotalTime = float32(i) / 60
+		if i >= 60 {
+			// a pause must not change the estimated rate
+			p.GameTotalTime += 5
+		}
+		p.VehicleSpeed = float32(i) * 0.5
+		p.VehicleGearIndex = uint8(i / 30)
+		p.RouteID = 300 + uint16(i)
+		p.StageCurrentDistance = float64(i) * 2.25
+		p.VehicleBrakeTemperatureFl = float32(i)
+		packets = append(packets, p)
+	}
+	fields := []string{"vehicle_speed", "vehicle_gear_index", "route_id", "stage_current_distance", "vehicle_brake_temperature_fl"}
+	ld := &LD{
+		Driver:  "driver",
+		Fields:  fields,
+		Rates:   map[string]int{"vehicle_brake_temperature_fl": 10},
+		Packets: packets,
+	}
+	buf := &bytes.Buffer{}
+	if _, err := ld.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	head := ldHead{}
+	at(t, b, 0, &head)
+	if head.Marker != 0x40 || head.NumChannels != uint32(len(fields)) || cstring(head.Driver[:]) != "driver" {
+		t.Fatalf("header %+v", head)
+	}
+	if head.EventPtr != uint32(binary.Size(head)) {
+		t.Errorf("event at %d, want %d", head.EventPtr, binary.Size(head))
+	}
+	event := ldEvent{}
+	at(t, b, head.EventPtr, &event)
+	venue := ldVenue{}
+	at(t, b, uint32(event.VenuePtr), &venue)
+	vehicle := ldVehicle{}
+	at(t, b, uint32(venue.VehiclePtr), &vehicle)
+	if want := uint32(venue.VehiclePtr) + uint32(binary.Size(vehicle)); head.MetaPtr != want {
+		t.Errorf("channels at %d, want %d", head.MetaPtr, want)
+	}
+
+	ptr, prev := head.MetaPtr, uint32(0)
+	end := head.DataPtr
+	for i, key := range fields {
+		if ptr == 0 {
+			t.Fatalf("channel list ends after %d channels", i)
+		}
+		ch := ldChan{}
+		at(t, b, ptr, &ch)
+		if ch.PrevPtr != prev {
+			t.Errorf("%s: previous %d, want %d", key, ch.PrevPtr, prev)
+		}
+		if cstring(ch.Name[:]) != key {
+			t.Errorf("channel %d name %q, want %q", i, ch.Name, key)
+		}
+		if got, want := cstring(ch.Unit[:]), packet.ChannelDicts[key].Units; !strings.HasPrefix(want, got) {
+			t.Errorf("%s: unit %q, want %q", key, got, want)
+		}
+		if ch.DataPtr != end {
+			t.Errorf("%s: data at %d, want %d", key, ch.DataPtr, end)
+		}
+		freq, n := 60, uint32(421)
+		if key == "vehicle_brake_temperature_fl" {
+			freq, n = 10, 71
+		}
+		if int(ch.Freq) != freq || ch.DataLen != n {
+			t.Errorf("%s: %d samples at %d Hz, want %d at %d Hz", key, ch.DataLen, ch.Freq, n, freq)
+		}
+		end = ch.DataPtr + ch.DataLen*uint32(ch.Type)
+		if end > uint32(len(b)) {
+			t.Fatalf("%s: data beyond the end", key)
+		}
+		sample := func(j int) float64 {
+			off := ch.DataPtr + uint32(j)*uint32(ch.Type)
+			switch {
+			case ch.TypeA == 0x07 && ch.Type == 4:
+				return float64(math.Float32frombits(endian.Uint32(b[off:])))
+			case ch.TypeA == 0x03 && ch.Type == 2:
+				return float64(int16(endian.Uint16(b[off:])))
+			case ch.TypeA == 0x05 && ch.Type == 4:
+				return float64(int32(endian.Uint32(b[off:])))
+			}
+			t.Fatalf("%s: type %#x size %d", key, ch.TypeA, ch.Type)
+			return 0
+		}
+		// the first packet, one on the grid, the last before the pause held
+		// during the pause and the last packet
+		for _, tc := range []struct {
+			time float64
+			pkt  int
+		}{{0, 0}, {0.5, 30}, {3, 59}, {7, 120}} {
+			want, _ := packets[tc.pkt].Float(key)
+			if got := sample(int(tc.time * float64(freq))); float32(got) != float32(want) {
+				t.Errorf("%s at %gs = %v, want %v", key, tc.time, got, want)
+			}
+		}
+		prev, ptr = ptr, ch.NextPtr
+	}
+	if ptr != 0 {
+		t.Errorf("channel list continues at %d", ptr)
+	}
+	if end != uint32(len(b)) {
+		t.Errorf("file size %d, want %d", len(b), end)
+	}
+}
+
+func TestShortNames(t *testing.T) {
+	names := shortNames(packet.New().Fields())
+	seen := map[string]bool{}
+	for _, name := range names {
+		if len(name) > 8 || seen[name] {
+			t.Errorf("short name %q too long or used twice", name)
+		}
+		seen[name] = true
+	}
+}
@@ -0,0 +1,227 @@
+// Package motion generates motion platform cues from the body-frame dynamics.
+//
+// Translational cues are body accelerations and rotational cues are the
+// car attitude and yaw rate. Each is high-pass filtered so the platform
+// washes back to neutral, sustained surge and sway accelerations are
+// rendered by tilting the platform (tilt coordination), and the result is
+// scaled to ±1 at the actuator limits and clamped.
+package motion
+
+import (
+	"math"
+
+	"github.com/nobonobo/easportswrc/dynamics"
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// G is the standard gravity in m/s².
+const G = 9.80665
+
+// Axis configures one degree of freedom.
+type Axis struct {
+	// Gain scales the cue before limiting. Default 1.
+	Gain float64
+	// Limit is the cue mapped to ±1: m/s² for surge, sway and heave, rad for
+	// roll and pitch, rad/s for yaw. Defaults 1g, 0.35 rad and 1 rad/s.
+	Limit float64
+	// Washout is the high-pass cutoff in Hz, negative to disable.
+	// Defaults 0.5 for surge, sway and heave and 0.1 for roll, pitch and yaw.
+	Washout float64
+}
+
+func (a *Axis) defaults(limit, washout float64) {
+	if a.Gain == 0 {
+		a.Gain = 1
+	}
+	if a.Limit <= 0 {
+		a.Limit = limit
+	}
+	if a.Washout == 0 {
+		a.Washout = washout
+	}
+}
+
+// Tilt configures tilt coordination.
+type Tilt struct {
+	// Off disables tilt coordination.
+	Off bool
+	// Cutoff is the low-pass cutoff in Hz of the tilted acceleration. Default 0.5.
+	Cutoff float64
+	// Limit is the largest tilt in rad. Default 0.2.
+	Limit float64
+	// Rate is the largest tilt rate in rad/s, kept low so it is not felt. Default 0.1.
+	Rate float64
+}
+
+type Options struct {
+	Surge, Sway, Heave Axis
+	Roll, Pitch, Yaw   Axis
+	Tilt               Tilt
+	// Dynamics configures the body-frame conversion.
+	Dynamics dynamics.Options
+}
+
+func (o *Options) defaults() {
+	o.Surge.defaults(G, 0.5)
+	o.Sway.defaults(G, 0.5)
+	o.Heave.defaults(G, 0.5)
+	o.Roll.defaults(0.35, 0.1)
+	o.Pitch.defaults(0.35, 0.1)
+	o.Yaw.defaults(1, 0.1)
+	if o.Tilt.Cutoff <= 0 {
+		o.Tilt.Cutoff = 0.5
+	}
+	if o.Tilt.Limit <= 0 {
+		o.Tilt.Limit = 0.2
+	}
+	if o.Tilt.Rate <= 0 {
+		o.Tilt.Rate = 0.1
+	}
+}
+
+// Setpoint holds the normalised cues in [-1, 1]. Surge is positive
+// forwards, sway to the left, heave upwards, roll with the left side up,
+// pitch with the nose up and yaw with the dynamics heading growing, turning
+// right in the game world.
+type Setpoint struct {
+	StageTime float32 `json:"stage_time"`
+	Surge     float64 `json:"surge"`
+	Sway      float64 `json:"sway"`
+	Heave     float64 `json:"heave"`
+	Roll      float64 `json:"roll"`
+	Pitch     float64 `json:"pitch"`
+	Yaw       float64 `json:"yaw"`
+}
+
+// highPass is a first order high-pass filter.
+type highPass struct {
+	cutoff float64
+	x, y   float64
+}
+
+func (f *highPass) update(x, dt float64) float64 {
+	if f.cutoff < 0 {
+		return x
+	}
+	rc := 1 / (2 * math.Pi * f.cutoff)
+	f.y = rc / (rc + dt) * (f.y + x - f.x)
+	f.x = x
+	return f.y
+}
+
+// lowPass is a first order low-pass filter.
+type lowPass struct {
+	cutoff float64
+	y      float64
+}
+
+func (f *lowPass) update(x, dt float64) float64 {
+	rc := 1 / (2 * math.Pi * f.cutoff)
+	f.y += dt / (rc + dt) * (x - f.y)
+	return f.y
+}
+
+type tilt struct {
+	lowPass
+	angle float64
+}
+
+// update returns the tilt angle whose gravity component renders the acceleration a.
+func (t *tilt) update(o *Tilt, a, dt float64) float64 {
+	a = t.lowPass.update(a, dt)
+	want := math.Asin(max(-1, min(1, a/G)))
+	want = max(-o.Limit, min(o.Limit, want))
+	step := o.Rate * dt
+	t.angle += max(-step, min(step, want-t.angle))
+	return t.angle
+}
+
+// maxGap is the packet gap in seconds after which the filters restart.
+const maxGap = 0.5
+
+type Cueing struct {
+	opts     Options
+	dynamics *dynamics.Tracker
+	started  bool
+	gameTime float32
+	hp       [6]highPass
+	tiltX    tilt
+	tiltZ    tilt
+}
+
+func New(opts Options) *Cueing {
+	opts.defaults()
+	c := &Cueing{opts: opts}
+	c.reset()
+	return c
+}
+
+func (c *Cueing) axes() []*Axis {
+	o := &c.opts
+	return []*Axis{&o.Surge, &o.Sway, &o.Heave, &o.Roll, &o.Pitch, &o.Yaw}
+}
+
+func (c *Cueing) reset() {
+	c.dynamics = dynamics.New(c.opts.Dynamics)
+	for i, a := range c.axes() {
+		c.hp[i] = highPass{cutoff: a.Washout}
+	}
+	c.tiltX = tilt{lowPass: lowPass{cutoff: c.opts.Tilt.Cutoff}}
+	c.tiltZ = tilt{lowPass: lowPass{cutoff: c.opts.Tilt.Cutoff}}
+	c.started = false
+}
+
+func normalise(a *Axis, v float64) float64 {
+	return max(-1, min(1, v*a.Gain/a.Limit))
+}
+
+// Update consumes a packet and returns the setpoint for it.
+func (c *Cueing) Update(p *packet.Packet) Setpoint {
+	dt := 0.0
+	if c.started {
+		dt = float64(p.Elapsed(c.gameTime))
+		// a rewind or restart sends the game clock back
+		if dt > maxGap || p.GameTotalTime < c.gameTime {
+			c.reset()
+			dt = 0
+		}
+	}
+	c.started, c.gameTime = true, p.GameTotalTime
+	s := c.dynamics.Update(p)
+	raw := []float64{s.AccelLongitudinal, s.AccelLateral, s.AccelVertical, s.Roll, s.Pitch, s.YawRate}
+	cue := [6]float64{}
+	for i := range raw {
+		if dt == 0 {
+			// prime the filters so the first packet does not kick
+			c.hp[i].x, c.hp[i].y = raw[i], 0
+			continue
+		}
+		cue[i] = c.hp[i].update(raw[i], dt)
+	}
+	if !c.opts.Tilt.Off && dt > 0 {
+		// accelerating forwards tilts the nose up, to the left tilts the left side up
+		cue[4] += c.tiltX.update(&c.opts.Tilt, s.AccelLongitudinal, dt)
+		cue[3] += c.tiltZ.update(&c.opts.Tilt, s.AccelLateral, dt)
+	}
+	axes := c.axes()
+	return Setpoint{
+		StageTime: p.StageCurrentTime,
+		Surge:     normalise(axes[0], cue[0]),
+		Sway:      normalise(axes[1], cue[1]),
+		Heave:     normalise(axes[2], cue[2]),
+		Roll:      normalise(axes[3], cue[3]),
+		Pitch:     normalise(axes[4], cue[4]),
+		Yaw:       normalise(axes[5], cue[5]),
+	}
+}
+
+// Run drives the sink with the setpoints of the packets.
+func Run(packets []*packet.Packet, sink Sink, opts Options) error {
+	c := New(opts)
+	for _, p := range packets {
+		if err := sink.Send(c.Update(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package motion
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// surge returns upright packets at 60 Hz with the forward accelerations in g.
+func surge(gs ...float64) []*packet.Packet {
+	packets := []*packet.Packet{}
+	for i, g := range gs {
+		p := packet.New()
+		p.GameTotalTime = float32(i) / 60
+		p.StageCurrentTime = p.GameTotalTime
+		p.GameDeltaTime = 1.0 / 60
+		p.VehicleForwardDirectionZ = 1
+		p.VehicleLeftDirectionX = -1
+		p.VehicleUpDirectionY = 1
+		p.VehicleAccelerationZ = float32(g * G)
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func repeat(g float64, n int) []float64 {
+	gs := make([]float64, n)
+	for i := range gs {
+		gs[i] = g
+	}
+	return gs
+}
+
+func cues(packets []*packet.Packet, opts Options) []Setpoint {
+	c := New(opts)
+	res := []Setpoint{}
+	for _, p := range packets {
+		res = append(res, c.Update(p))
+	}
+	return res
+}
+
+func TestWashout(t *testing.T) {
+	noTilt := Options{Tilt: Tilt{Off: true}}
+	// braking from the first packet does not kick
+	for i, s := range cues(surge(repeat(-0.5, 60)...), noTilt) {
+		if s.Surge != 0 {
+			t.Fatalf("surge %v at packet %d", s.Surge, i)
+		}
+	}
+	step := cues(surge(append([]float64{0}, repeat(0.5, 600)...)...), noTilt)
+	rc := 1 / (2 * math.Pi * 0.5)
+	if s, want := step[1].Surge, 0.5*rc/(rc+1.0/60); math.Abs(s-want) > 1e-6 {
+		t.Errorf("surge %v at the step, want %v", s, want)
+	}
+	for i := 2; i < len(step); i++ {
+		if step[i].Surge > step[i-1].Surge || step[i].Surge < 0 {
+			t.Fatalf("surge %v after %v", step[i].Surge, step[i-1].Surge)
+		}
+	}
+	if s := step[len(step)-1].Surge; s > 0.01 {
+		t.Errorf("surge %v after 10s, want washed out", s)
+	}
+	for _, tc := range []struct {
+		name string
+		g    float64
+		axis Axis
+		want float64
+	}{
+		{"sustained", 0.5, Axis{Washout: -1}, 0.5},
+		{"gain", 0.5, Axis{Washout: -1, Gain: 0.5}, 0.25},
+		{"limit", 0.5, Axis{Washout: -1, Limit: 2 * G}, 0.25},
+		{"clamped", 3, Axis{Washout: -1}, 1},
+		{"clamped braking", -3, Axis{Washout: -1}, -1},
+	} {
+		opts := noTilt
+		opts.Surge = tc.axis
+		s := cues(surge(append([]float64{0}, repeat(tc.g, 120)...)...), opts)
+		if got := s[len(s)-1].Surge; math.Abs(got-tc.want) > 1e-4 {
+			t.Errorf("%s: surge %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTilt(t *testing.T) {
+	s := cues(surge(append([]float64{0}, repeat(0.3, 1200)...)...), Options{})
+	// the tilt rate is limited to 0.1 rad/s and the tilt to 0.2 rad
+	if p := s[60].Pitch; p <= 0 || p > 0.1/0.35+1e-6 {
+		t.Errorf("pitch %v after 1s", p)
+	}
+	if p := s[len(s)-1].Pitch; math.Abs(p-0.2/0.35) > 1e-3 {
+		t.Errorf("pitch %v after 20s, want the tilt limit", p)
+	}
+	if r := s[len(s)-1].Roll; r != 0 {
+		t.Errorf("roll %v accelerating straight", r)
+	}
+	if s := cues(surge(append([]float64{0}, repeat(0.3, 120)...)...), Options{Tilt: Tilt{Off: true}}); s[len(s)-1].Pitch != 0 {
+		t.Errorf("pitch %v without tilt coordination", s[len(s)-1].Pitch)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	opts := Options{Tilt: Tilt{Off: true}, Surge: Axis{Washout: -1}}
+	for _, tc := range []struct {
+		name  string
+		shift func(p *packet.Packet)
+	}{
+		{"gap", func(p *packet.Packet) { p.GameTotalTime += 1 }},
+		{"rewind", func(p *packet.Packet) { p.GameTotalTime -= 5 }},
+	} {
+		packets := surge(0, 0, 0, 0.5, 0.5)
+		for _, p := range packets[3:] {
+			tc.shift(p)
+		}
+		s := cues(packets, opts)
+		// the filters start over primed with the acceleration after the jump
+		if s[2].Surge != 0 || s[3].Surge != 0 || math.Abs(s[4].Surge-0.5) > 1e-6 {
+			t.Errorf("%s: surge %v and %v", tc.name, s[3].Surge, s[4].Surge)
+		}
+	}
+	// repeated game times fall back to the frame time
+	packets := surge(0, 0.5)
+	packets[1].GameTotalTime = packets[0].GameTotalTime
+	if s := cues(packets, opts); math.Abs(s[1].Surge-0.5) > 1e-6 {
+		t.Errorf("surge %v on a repeated game time", s[1].Surge)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewFileSink(buf)
+	if err := Run(surge(0, 0.5, 0.5), sink, Options{Tilt: Tilt{Off: true}, Surge: Axis{Washout: -1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sc := bufio.NewScanner(buf)
+	n := 0
+	for sc.Scan() {
+		var s Setpoint
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		n++
+		if n == 3 && (math.Abs(s.Surge-0.5) > 1e-6 || s.Format() != "0.5000,0.0000,0.0000,0.0000,0.0000,0.0000") {
+			t.Errorf("setpoint %+v formatted %s", s, s.Format())
+		}
+	}
+	if n != 3 {
+		t.Errorf("%d setpoints, want 3", n)
+	}
+}
@@ -0,0 +1,74 @@
+package motion
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Sink receives setpoints.
+type Sink interface {
+	Send(s Setpoint) error
+	Close() error
+}
+
+// Format returns the setpoint as a line of comma separated values in the
+// order surge, sway, heave, roll, pitch, yaw.
+func (s Setpoint) Format() string {
+	return fmt.Sprintf("%.4f,%.4f,%.4f,%.4f,%.4f,%.4f", s.Surge, s.Sway, s.Heave, s.Roll, s.Pitch, s.Yaw)
+}
+
+// UDPSink sends each setpoint as one Format datagram.
+type UDPSink struct {
+	conn net.Conn
+}
+
+func NewUDPSink(addr string) (*UDPSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPSink{conn: conn}, nil
+}
+
+func (s *UDPSink) Send(sp Setpoint) error {
+	_, err := s.conn.Write([]byte(sp.Format()))
+	return err
+}
+
+func (s *UDPSink) Close() error {
+	return s.conn.Close()
+}
+
+// FileSink writes setpoints as JSON Lines, for testing and plotting.
+type FileSink struct {
+	w   *bufio.Writer
+	c   io.Closer
+	enc *json.Encoder
+}
+
+// NewFileSink writes to w, closing it on Close when it is an io.Closer.
+func NewFileSink(w io.Writer) *FileSink {
+	bw := bufio.NewWriter(w)
+	s := &FileSink{w: bw, enc: json.NewEncoder(bw)}
+	if c, ok := w.(io.Closer); ok {
+		s.c = c
+	}
+	return s
+}
+
+func (s *FileSink) Send(sp Setpoint) error {
+	return s.enc.Encode(sp)
+}
+
+func (s *FileSink) Close() error {
+	err := s.w.Flush()
+	if s.c != nil {
+		if cerr := s.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package packet
+
+import "math"
+
+// Orientation conventions
+//
+// The game world is left-handed with X right, Y up and Z forward. The body
+// frame of the car uses the same handedness with x to the right, y up and z
+// forward, so a car at rest facing +Z has the identity orientation.
+//
+// Matrix maps body to world coordinates, world = M · body. Its columns are
+// the right (-Left), up and forward direction vectors.
+//
+// Euler angles are applied yaw about Y, then pitch about the new x, then
+// roll about the new z: M = Ry(yaw) · Rx(-pitch) · Rz(-roll) with
+//
+//	Rx(a) = [1 0 0; 0 cos -sin; 0 sin cos]
+//	Ry(a) = [cos 0 sin; 0 1 0; -sin 0 cos]
+//	Rz(a) = [cos -sin 0; sin cos 0; 0 0 1]
+//
+// In the game that is yaw positive turning the nose towards +X, pitch
+// positive with the nose up and roll positive with the left side up, the
+// same signs as the dynamics package. Angles are in radians.
+
+// Matrix is a row-major 3x3 rotation matrix.
+type Matrix [3][3]float64
+
+// Quaternion is a unit quaternion W + Xi + Yj + Zk with the same rotation as Matrix.
+type Quaternion struct {
+	W, X, Y, Z float64
+}
+
+// Euler holds the Euler angles of an orientation.
+type Euler struct {
+	Yaw   float64 `json:"yaw"`
+	Pitch float64 `json:"pitch"`
+	Roll  float64 `json:"roll"`
+}
+
+// Rotation returns the orientation of the car as a rotation matrix.
+func (p *Packet) Rotation() Matrix {
+	r := [3]float64{-float64(p.VehicleLeftDirectionX), -float64(p.VehicleLeftDirectionY), -float64(p.VehicleLeftDirectionZ)}
+	u := [3]float64{float64(p.VehicleUpDirectionX), float64(p.VehicleUpDirectionY), float64(p.VehicleUpDirectionZ)}
+	f := [3]float64{float64(p.VehicleForwardDirectionX), float64(p.VehicleForwardDirectionY), float64(p.VehicleForwardDirectionZ)}
+	m := Matrix{}
+	for i := 0; i < 3; i++ {
+		m[i] = [3]float64{r[i], u[i], f[i]}
+	}
+	return m
+}
+
+// Quaternion returns the orientation of the car as a unit quaternion.
+func (p *Packet) Quaternion() Quaternion {
+	return p.Rotation().Quaternion()
+}
+
+// Euler returns the orientation of the car as Euler angles.
+func (p *Packet) Euler() Euler {
+	return p.Rotation().Euler()
+}
+
+// Apply rotates v.
+func (m Matrix) Apply(v [3]float64) [3]float64 {
+	return [3]float64{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// Euler returns the Euler angles of the matrix. Near ±90° of pitch the yaw
+// and roll are ambiguous and roll is returned as zero.
+func (m Matrix) Euler() Euler {
+	e := Euler{Pitch: math.Asin(max(-1, min(1, m[1][2])))}
+	if math.Abs(m[1][2]) > 1-1e-9 {
+		e.Yaw = math.Atan2(-m[2][0], m[0][0])
+		return e
+	}
+	e.Yaw = math.Atan2(m[0][2], m[2][2])
+	e.Roll = math.Atan2(-m[1][0], m[1][1])
+	return e
+}
+
+// Quaternion returns the quaternion of the matrix, normalised so that
+// slightly skewed direction vectors still give a unit quaternion.
+func (m Matrix) Quaternion() Quaternion {
+	q := Quaternion{}
+	switch tr := m[0][0] + m[1][1] + m[2][2]; {
+	case tr > 0:
+		s := 2 * math.Sqrt(tr+1)
+		q = Quaternion{W: s / 4, X: (m[2][1] - m[1][2]) / s, Y: (m[0][2] - m[2][0]) / s, Z: (m[1][0] - m[0][1]) / s}
+	case m[0][0] > m[1][1] && m[0][0] > m[2][2]:
+		s := 2 * math.Sqrt(1+m[0][0]-m[1][1]-m[2][2])
+		q = Quaternion{W: (m[2][1] - m[1][2]) / s, X: s / 4, Y: (m[0][1] + m[1][0]) / s, Z: (m[0][2] + m[2][0]) / s}
+	case m[1][1] > m[2][2]:
+		s := 2 * math.Sqrt(1+m[1][1]-m[0][0]-m[2][2])
+		q = Quaternion{W: (m[0][2] - m[2][0]) / s, X: (m[0][1] + m[1][0]) / s, Y: s / 4, Z: (m[1][2] + m[2][1]) / s}
+	default:
+		s := 2 * math.Sqrt(1+m[2][2]-m[0][0]-m[1][1])
+		q = Quaternion{W: (m[1][0] - m[0][1]) / s, X: (m[0][2] + m[2][0]) / s, Y: (m[1][2] + m[2][1]) / s, Z: s / 4}
+	}
+	return q.Normalize()
+}
+
+// Matrix returns the rotation matrix of a unit quaternion.
+func (q Quaternion) Matrix() Matrix {
+	w, x, y, z := q.W, q.X, q.Y, q.Z
+	return Matrix{
+		{1 - 2*(y*y+z*z), 2 * (x*y - w*z), 2 * (x*z + w*y)},
+		{2 * (x*y + w*z), 1 - 2*(x*x+z*z), 2 * (y*z - w*x)},
+		{2 * (x*z - w*y), 2 * (y*z + w*x), 1 - 2*(x*x+y*y)},
+	}
+}
+
+// Euler returns the Euler angles of a unit quaternion.
+func (q Quaternion) Euler() Euler {
+	return q.Matrix().Euler()
+}
+
+func (q Quaternion) dot(r Quaternion) float64 {
+	return q.W*r.W + q.X*r.X + q.Y*r.Y + q.Z*r.Z
+}
+
+func (q Quaternion) scale(s float64) Quaternion {
+	return Quaternion{q.W * s, q.X * s, q.Y * s, q.Z * s}
+}
+
+func (q Quaternion) add(r Quaternion) Quaternion {
+	return Quaternion{q.W + r.W, q.X + r.X, q.Y + r.Y, q.Z + r.Z}
+}
+
+// Normalize returns q scaled to unit length, the identity for a zero quaternion.
+func (q Quaternion) Normalize() Quaternion {
+	n := math.Sqrt(q.dot(q))
+	if n == 0 {
+		return Quaternion{W: 1}
+	}
+	return q.scale(1 / n)
+}
+
+// Slerp interpolates along the shortest arc from q at t=0 to r at t=1.
+func Slerp(q, r Quaternion, t float64) Quaternion {
+	d := q.dot(r)
+	if d < 0 {
+		r, d = r.scale(-1), -d
+	}
+	if d > 0.9995 {
+		// nearly parallel, linear interpolation is accurate and stable
+		return q.scale(1 - t).add(r.scale(t)).Normalize()
+	}
+	theta := math.Acos(d)
+	s := math.Sin(theta)
+	return q.scale(math.Sin((1-t)*theta) / s).add(r.scale(math.Sin(t*theta) / s))
+}
+
+// Pose is the position and orientation of the car.
+type Pose struct {
+	Position    [3]float64 `json:"position"`
+	Orientation Quaternion `json:"orientation"`
+}
+
+// Interpolate returns the pose of the car between a at t=0 and b at t=1,
+// linear in position and slerped in orientation.
+func Interpolate(a, b *Packet, t float64) Pose {
+	lerp := func(x, y float32) float64 {
+		return float64(x) + (float64(y)-float64(x))*t
+	}
+	return Pose{
+		Position: [3]float64{
+			lerp(a.VehiclePositionX, b.VehiclePositionX),
+			lerp(a.VehiclePositionY, b.VehiclePositionY),
+			lerp(a.VehiclePositionZ, b.VehiclePositionZ),
+		},
+		Orientation: Slerp(a.Quaternion(), b.Quaternion(), t),
+	}
+}
+
+// InterpolateTime is Interpolate at the game time, clamped to the two packets.
+func InterpolateTime(a, b *Packet, gameTime float32) Pose {
+	t := 0.0
+	if d := b.GameTotalTime - a.GameTotalTime; d > 0 {
+		t = max(0, min(1, float64((gameTime-a.GameTotalTime)/d)))
+	}
+	return Interpolate(a, b, t)
+}
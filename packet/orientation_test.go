@@ -0,0 +1,123 @@
+package packet
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-5
+}
+
+// orient sets the direction vectors of p from the columns of m.
+func orient(p *Packet, m Matrix) {
+	p.VehicleLeftDirectionX, p.VehicleLeftDirectionY, p.VehicleLeftDirectionZ = -float32(m[0][0]), -float32(m[1][0]), -float32(m[2][0])
+	p.VehicleUpDirectionX, p.VehicleUpDirectionY, p.VehicleUpDirectionZ = float32(m[0][1]), float32(m[1][1]), float32(m[2][1])
+	p.VehicleForwardDirectionX, p.VehicleForwardDirectionY, p.VehicleForwardDirectionZ = float32(m[0][2]), float32(m[1][2]), float32(m[2][2])
+}
+
+func fromEuler(e Euler) Matrix {
+	cy, sy := math.Cos(e.Yaw), math.Sin(e.Yaw)
+	cp, sp := math.Cos(-e.Pitch), math.Sin(-e.Pitch)
+	cr, sr := math.Cos(-e.Roll), math.Sin(-e.Roll)
+	ry := Matrix{{cy, 0, sy}, {0, 1, 0}, {-sy, 0, cy}}
+	rx := Matrix{{1, 0, 0}, {0, cp, -sp}, {0, sp, cp}}
+	rz := Matrix{{cr, -sr, 0}, {sr, cr, 0}, {0, 0, 1}}
+	mul := func(a, b Matrix) Matrix {
+		m := Matrix{}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				for k := 0; k < 3; k++ {
+					m[i][j] += a[i][k] * b[k][j]
+				}
+			}
+		}
+		return m
+	}
+	return mul(ry, mul(rx, rz))
+}
+
+func TestOrientationIdentity(t *testing.T) {
+	p := New()
+	p.VehicleLeftDirectionX = -1
+	p.VehicleUpDirectionY = 1
+	p.VehicleForwardDirectionZ = 1
+	if q := p.Quaternion(); !near(q.W, 1) || !near(q.X, 0) || !near(q.Y, 0) || !near(q.Z, 0) {
+		t.Errorf("quaternion %v, want identity", q)
+	}
+	if e := p.Euler(); e != (Euler{}) {
+		t.Errorf("euler %v, want zero", e)
+	}
+}
+
+func TestOrientationConventions(t *testing.T) {
+	p := New()
+	// nose towards +X
+	orient(p, fromEuler(Euler{Yaw: math.Pi / 2}))
+	if !near(float64(p.VehicleForwardDirectionX), 1) {
+		t.Errorf("yaw forward %v %v %v", p.VehicleForwardDirectionX, p.VehicleForwardDirectionY, p.VehicleForwardDirectionZ)
+	}
+	// nose up
+	orient(p, fromEuler(Euler{Pitch: 0.3}))
+	if p.VehicleForwardDirectionY <= 0 {
+		t.Errorf("pitch forward y %v, want positive", p.VehicleForwardDirectionY)
+	}
+	// left side up, right side down
+	orient(p, fromEuler(Euler{Roll: 0.3}))
+	if p.VehicleLeftDirectionY <= 0 {
+		t.Errorf("roll left y %v, want positive", p.VehicleLeftDirectionY)
+	}
+}
+
+func TestOrientationRoundTrip(t *testing.T) {
+	p := New()
+	for _, want := range []Euler{
+		{Yaw: 0.5, Pitch: 0.2, Roll: -0.3},
+		{Yaw: -2.8, Pitch: -1.2, Roll: 2.9},
+		{Yaw: 3, Pitch: 0.7, Roll: 1.5},
+	} {
+		orient(p, fromEuler(want))
+		got := p.Euler()
+		if !near(got.Yaw, want.Yaw) || !near(got.Pitch, want.Pitch) || !near(got.Roll, want.Roll) {
+			t.Errorf("euler %v, want %v", got, want)
+		}
+		m, qm := p.Rotation(), p.Quaternion().Matrix()
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				if !near(m[i][j], qm[i][j]) {
+					t.Fatalf("quaternion matrix %v, want %v", qm, m)
+				}
+			}
+		}
+	}
+}
+
+func TestSlerp(t *testing.T) {
+	a := fromEuler(Euler{Yaw: 0.2}).Quaternion()
+	b := fromEuler(Euler{Yaw: 1.4}).Quaternion()
+	for _, tc := range []struct{ t, yaw float64 }{{0, 0.2}, {0.25, 0.5}, {0.5, 0.8}, {1, 1.4}} {
+		if e := Slerp(a, b, tc.t).Euler(); !near(e.Yaw, tc.yaw) || !near(e.Pitch, 0) || !near(e.Roll, 0) {
+			t.Errorf("slerp %v = %v, want yaw %v", tc.t, e, tc.yaw)
+		}
+	}
+	// the opposite sign of b is the same rotation and must take the short arc too
+	neg := Quaternion{-b.W, -b.X, -b.Y, -b.Z}
+	if e := Slerp(a, neg, 0.5).Euler(); !near(e.Yaw, 0.8) {
+		t.Errorf("slerp negated = %v, want yaw 0.8", e)
+	}
+}
+
+func TestInterpolateTime(t *testing.T) {
+	a, b := New(), New()
+	a.GameTotalTime, b.GameTotalTime = 10, 11
+	a.VehiclePositionX, b.VehiclePositionX = 0, 4
+	orient(a, fromEuler(Euler{Roll: 0}))
+	orient(b, fromEuler(Euler{Roll: 0.4}))
+	pose := InterpolateTime(a, b, 10.25)
+	if !near(pose.Position[0], 1) {
+		t.Errorf("position %v, want 1", pose.Position[0])
+	}
+	if e := pose.Orientation.Euler(); !near(e.Roll, 0.1) {
+		t.Errorf("roll %v, want 0.1", e.Roll)
+	}
+}
@@ -27,7 +27,7 @@ type Packet struct {
 	VehicleGearMaximum        uint8   `json:"vehicle_gear_maximum"`
 	VehicleSpeed              float32 `json:"vehicle_speed"`
 	VehicleTransmissionSpeed  float32 `json:"vehicle_transmission_speed"`
-	VehiclePositionX          float32 `json:"VehiclePositionX"`
+	VehiclePositionX          float32 `json:"vehicle_position_x"`
 	VehiclePositionY          float32 `json:"vehicle_position_y"`
 	VehiclePositionZ          float32 `json:"vehicle_position_z"`
 	VehicleVelocityX          float32 `json:"vehicle_velocity_x"`
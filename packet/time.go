@@ -0,0 +1,23 @@
+package packet
+
+// Elapsed returns the game time in seconds since gameTime, the
+// GameTotalTime of the previous packet. Packets may be sent less often
+// than frames or dropped, so the game time between them counts and
+// GameDeltaTime is only the fallback when the clock did not advance.
+// The result is never negative.
+func (p *Packet) Elapsed(gameTime float32) float32 {
+	if d := p.GameTotalTime - gameTime; d > 0 {
+		return d
+	}
+	return max(0, p.GameDeltaTime)
+}
+
+// RestartTolerance is how far in seconds the stage clock may go back
+// before it is taken as a restart rather than jitter.
+const RestartTolerance = 0.5
+
+// Restarted reports whether the stage clock went back from stageTime, the
+// StageCurrentTime of the previous packet, by more than tolerance seconds.
+func (p *Packet) Restarted(stageTime, tolerance float32) bool {
+	return p.StageCurrentTime+tolerance < stageTime
+}
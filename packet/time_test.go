@@ -0,0 +1,42 @@
+package packet
+
+import "testing"
+
+func TestElapsed(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		prev, now, delta float32
+		want             float32
+	}{
+		{"game time", 10, 10.5, 1.0 / 60, 0.5},
+		{"same frame", 10, 10, 1.0 / 60, 1.0 / 60},
+		{"rewound", 10, 4, 1.0 / 60, 1.0 / 60},
+		{"paused", 10, 10, 0, 0},
+		{"negative delta", 10, 9, -1, 0},
+	} {
+		p := New()
+		p.GameTotalTime, p.GameDeltaTime = tc.now, tc.delta
+		if got := p.Elapsed(tc.prev); got != tc.want {
+			t.Errorf("%s: %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRestarted(t *testing.T) {
+	for _, tc := range []struct {
+		prev, now float32
+		want      bool
+	}{
+		{10, 10.1, false},
+		{10, 10, false},
+		{10, 9.6, false},
+		{10, 9.4, true},
+		{10, 0, true},
+	} {
+		p := New()
+		p.StageCurrentTime = tc.now
+		if got := p.Restarted(tc.prev, RestartTolerance); got != tc.want {
+			t.Errorf("from %v to %v: %v, want %v", tc.prev, tc.now, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package packet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ref returns a pointer to the field backing the channel key.
+func (p *Packet) ref(key string) (any, error) {
+	switch key {
+	default:
+		return nil, fmt.Errorf("unknown field %s", key)
+	case "packet_4cc":
+		return &p.Packet4CC, nil
+	case "packet_uid":
+		return &p.PacketUID, nil
+	case "shiftlights_fraction":
+		return &p.ShiftlightsFraction, nil
+	case "shiftlights_rpm_start":
+		return &p.ShiftlightsRpmStart, nil
+	case "shiftlights_rpm_end":
+		return &p.ShiftlightsRpmEnd, nil
+	case "shiftlights_rpm_valid":
+		return &p.ShiftlightsRpmValid, nil
+	case "vehicle_gear_index":
+		return &p.VehicleGearIndex, nil
+	case "vehicle_gear_index_neutral":
+		return &p.VehicleGearIndexNeutral, nil
+	case "vehicle_gear_index_reverse":
+		return &p.VehicleGearIndexReverse, nil
+	case "vehicle_gear_maximum":
+		return &p.VehicleGearMaximum, nil
+	case "vehicle_speed":
+		return &p.VehicleSpeed, nil
+	case "vehicle_transmission_speed":
+		return &p.VehicleTransmissionSpeed, nil
+	case "vehicle_position_x":
+		return &p.VehiclePositionX, nil
+	case "vehicle_position_y":
+		return &p.VehiclePositionY, nil
+	case "vehicle_position_z":
+		return &p.VehiclePositionZ, nil
+	case "vehicle_velocity_x":
+		return &p.VehicleVelocityX, nil
+	case "vehicle_velocity_y":
+		return &p.VehicleVelocityY, nil
+	case "vehicle_velocity_z":
+		return &p.VehicleVelocityZ, nil
+	case "vehicle_acceleration_x":
+		return &p.VehicleAccelerationX, nil
+	case "vehicle_acceleration_y":
+		return &p.VehicleAccelerationY, nil
+	case "vehicle_acceleration_z":
+		return &p.VehicleAccelerationZ, nil
+	case "vehicle_left_direction_x":
+		return &p.VehicleLeftDirectionX, nil
+	case "vehicle_left_direction_y":
+		return &p.VehicleLeftDirectionY, nil
+	case "vehicle_left_direction_z":
+		return &p.VehicleLeftDirectionZ, nil
+	case "vehicle_forward_direction_x":
+		return &p.VehicleForwardDirectionX, nil
+	case "vehicle_forward_direction_y":
+		return &p.VehicleForwardDirectionY, nil
+	case "vehicle_forward_direction_z":
+		return &p.VehicleForwardDirectionZ, nil
+	case "vehicle_up_direction_x":
+		return &p.VehicleUpDirectionX, nil
+	case "vehicle_up_direction_y":
+		return &p.VehicleUpDirectionY, nil
+	case "vehicle_up_direction_z":
+		return &p.VehicleUpDirectionZ, nil
+	case "vehicle_hub_position_bl":
+		return &p.VehicleHubPositionBl, nil
+	case "vehicle_hub_position_br":
+		return &p.VehicleHubPositionBr, nil
+	case "vehicle_hub_position_fl":
+		return &p.VehicleHubPositionFl, nil
+	case "vehicle_hub_position_fr":
+		return &p.VehicleHubPositionFr, nil
+	case "vehicle_hub_velocity_bl":
+		return &p.VehicleHubVelocityBl, nil
+	case "vehicle_hub_velocity_br":
+		return &p.VehicleHubVelocityBr, nil
+	case "vehicle_hub_velocity_fl":
+		return &p.VehicleHubVelocityFl, nil
+	case "vehicle_hub_velocity_fr":
+		return &p.VehicleHubVelocityFr, nil
+	case "vehicle_cp_forward_speed_bl":
+		return &p.VehicleCpForwardSpeedBl, nil
+	case "vehicle_cp_forward_speed_br":
+		return &p.VehicleCpForwardSpeedBr, nil
+	case "vehicle_cp_forward_speed_fl":
+		return &p.VehicleCpForwardSpeedFl, nil
+	case "vehicle_cp_forward_speed_fr":
+		return &p.VehicleCpForwardSpeedFr, nil
+	case "vehicle_brake_temperature_bl":
+		return &p.VehicleBrakeTemperatureBl, nil
+	case "vehicle_brake_temperature_br":
+		return &p.VehicleBrakeTemperatureBr, nil
+	case "vehicle_brake_temperature_fl":
+		return &p.VehicleBrakeTemperatureFl, nil
+	case "vehicle_brake_temperature_fr":
+		return &p.VehicleBrakeTemperatureFr, nil
+	case "vehicle_engine_rpm_max":
+		return &p.VehicleEngineRpmMax, nil
+	case "vehicle_engine_rpm_idle":
+		return &p.VehicleEngineRpmIdle, nil
+	case "vehicle_engine_rpm_current":
+		return &p.VehicleEngineRpmCurrent, nil
+	case "vehicle_throttle":
+		return &p.VehicleThrottle, nil
+	case "vehicle_brake":
+		return &p.VehicleBrake, nil
+	case "vehicle_clutch":
+		return &p.VehicleClutch, nil
+	case "vehicle_steering":
+		return &p.VehicleSteering, nil
+	case "vehicle_handbrake":
+		return &p.VehicleHandbrake, nil
+	case "game_total_time":
+		return &p.GameTotalTime, nil
+	case "game_delta_time":
+		return &p.GameDeltaTime, nil
+	case "game_frame_count":
+		return &p.GameFrameCount, nil
+	case "stage_current_time":
+		return &p.StageCurrentTime, nil
+	case "stage_previous_split_time":
+		return &p.StagePreviousSplitTime, nil
+	case "stage_result_time":
+		return &p.StageResultTime, nil
+	case "stage_result_time_penalty":
+		return &p.StageResultTimePenalty, nil
+	case "stage_result_status":
+		return &p.StageResultStatus, nil
+	case "stage_current_distance":
+		return &p.StageCurrentDistance, nil
+	case "stage_length":
+		return &p.StageLength, nil
+	case "stage_progress":
+		return &p.StageProgress, nil
+	case "vehicle_tyre_state_bl":
+		return &p.VehicleTyreStateBl, nil
+	case "vehicle_tyre_state_br":
+		return &p.VehicleTyreStateBr, nil
+	case "vehicle_tyre_state_fl":
+		return &p.VehicleTyreStateFl, nil
+	case "vehicle_tyre_state_fr":
+		return &p.VehicleTyreStateFr, nil
+	case "stage_shakedown":
+		return &p.StageShakedown, nil
+	case "game_mode":
+		return &p.GameMode, nil
+	case "vehicle_id":
+		return &p.VehicleID, nil
+	case "vehicle_class_id":
+		return &p.VehicleClassID, nil
+	case "vehicle_manufacturer_id":
+		return &p.VehicleManufacturerID, nil
+	case "location_id":
+		return &p.LocationID, nil
+	case "route_id":
+		return &p.RouteID, nil
+	case "vehicle_cluster_abs":
+		return &p.VehicleClusterAbs, nil
+	}
+}
+
+// Value returns the value of the channel key with its native type.
+func (p *Packet) Value(key string) (any, error) {
+	r, err := p.ref(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := r.(type) {
+	case *[4]byte:
+		return *v, nil
+	case *bool:
+		return *v, nil
+	case *uint8:
+		return *v, nil
+	case *uint16:
+		return *v, nil
+	case *uint64:
+		return *v, nil
+	case *float32:
+		return *v, nil
+	case *float64:
+		return *v, nil
+	}
+	return nil, fmt.Errorf("unsupported field %s", key)
+}
+
+// SetValue stores v into the channel key. v must have the native type of the channel.
+func (p *Packet) SetValue(key string, v any) error {
+	r, err := p.ref(key)
+	if err != nil {
+		return err
+	}
+	ok := false
+	switch dst := r.(type) {
+	case *[4]byte:
+		*dst, ok = v.([4]byte)
+	case *bool:
+		*dst, ok = v.(bool)
+	case *uint8:
+		*dst, ok = v.(uint8)
+	case *uint16:
+		*dst, ok = v.(uint16)
+	case *uint64:
+		*dst, ok = v.(uint64)
+	case *float32:
+		*dst, ok = v.(float32)
+	case *float64:
+		*dst, ok = v.(float64)
+	}
+	if !ok {
+		return fmt.Errorf("invalid value type %T for field %s", v, key)
+	}
+	return nil
+}
+
+// Float returns the channel key as float64. booleans are 0 or 1.
+func (p *Packet) Float(key string) (float64, error) {
+	v, err := p.Value(key)
+	if err != nil {
+		return 0, err
+	}
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("field %s is not numeric", key)
+}
+
+// formatFourCC returns the 4CC as text without trailing NULs when it is
+// printable ASCII and as 0x followed by 8 hex digits otherwise, which is
+// longer than any text form.
+func formatFourCC(v [4]byte) string {
+	text := strings.TrimRight(string(v[:]), "\x00")
+	printable := !strings.HasPrefix(text, "0x")
+	for i := 0; i < len(text); i++ {
+		if text[i] < 0x20 || text[i] > 0x7e {
+			printable = false
+		}
+	}
+	if printable {
+		return text
+	}
+	return "0x" + hex.EncodeToString(v[:])
+}
+
+func parseFourCC(s string) ([4]byte, error) {
+	v := [4]byte{}
+	if len(s) == 10 && strings.HasPrefix(s, "0x") {
+		_, err := hex.Decode(v[:], []byte(s[2:]))
+		return v, err
+	}
+	if len(s) > len(v) {
+		return v, fmt.Errorf("invalid fourcc %q", s)
+	}
+	copy(v[:], s)
+	return v, nil
+}
+
+// FormatValue returns the channel key as text that ParseValue reads back losslessly.
+func (p *Packet) FormatValue(key string) (string, error) {
+	v, err := p.Value(key)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case [4]byte:
+		return formatFourCC(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported field %s", key)
+}
+
+// ParseValue parses s as formatted by FormatValue and stores it into the channel key.
+func (p *Packet) ParseValue(key, s string) error {
+	r, err := p.ref(key)
+	if err != nil {
+		return err
+	}
+	switch dst := r.(type) {
+	case *[4]byte:
+		*dst, err = parseFourCC(s)
+	case *bool:
+		*dst, err = strconv.ParseBool(s)
+	case *uint8:
+		var v uint64
+		v, err = strconv.ParseUint(s, 10, 8)
+		*dst = uint8(v)
+	case *uint16:
+		var v uint64
+		v, err = strconv.ParseUint(s, 10, 16)
+		*dst = uint16(v)
+	case *uint64:
+		*dst, err = strconv.ParseUint(s, 10, 64)
+	case *float32:
+		var v float64
+		v, err = strconv.ParseFloat(s, 32)
+		*dst = float32(v)
+	case *float64:
+		*dst, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("field %s: %w", key, err)
+	}
+	return nil
+}
+
+// Name returns the resolved name of an ID channel such as vehicle_id or route_id.
+// ok is false when key is not an ID channel.
+func (p *Packet) Name(key string) (name string, ok bool) {
+	switch key {
+	default:
+		return "", false
+	case "game_mode":
+		return p.GameModeString(), true
+	case "location_id":
+		return p.Location(), true
+	case "route_id":
+		return p.Route(), true
+	case "vehicle_id":
+		return p.Vehicle(), true
+	case "vehicle_class_id":
+		return p.VehicleClass(), true
+	case "vehicle_manufacturer_id":
+		return p.VehicleManufacturer(), true
+	case "vehicle_tyre_state_fl":
+		return p.VehicleTyreState(ForwardLeft), true
+	case "vehicle_tyre_state_fr":
+		return p.VehicleTyreState(ForwardRight), true
+	case "vehicle_tyre_state_bl":
+		return p.VehicleTyreState(BackwordLeft), true
+	case "vehicle_tyre_state_br":
+		return p.VehicleTyreState(BackwordRight), true
+	case "stage_result_status":
+		return p.StageResultStatusString(), true
+	}
+}
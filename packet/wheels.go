@@ -0,0 +1,78 @@
+package packet
+
+// Positions lists the wheels in channel order.
+var Positions = []Position{ForwardLeft, ForwardRight, BackwordLeft, BackwordRight}
+
+// Wheels holds one value per wheel.
+type Wheels struct {
+	Fl float32 `json:"fl"`
+	Fr float32 `json:"fr"`
+	Bl float32 `json:"bl"`
+	Br float32 `json:"br"`
+}
+
+// Max returns the largest of the four values.
+func (w Wheels) Max() float32 {
+	return max(w.Fl, w.Fr, w.Bl, w.Br)
+}
+
+// Get returns the value of the wheel.
+func (w Wheels) Get(pos Position) float32 {
+	switch pos {
+	case ForwardLeft:
+		return w.Fl
+	case ForwardRight:
+		return w.Fr
+	case BackwordLeft:
+		return w.Bl
+	}
+	return w.Br
+}
+
+// Set sets the value of the wheel.
+func (w *Wheels) Set(pos Position, v float32) {
+	switch pos {
+	case ForwardLeft:
+		w.Fl = v
+	case ForwardRight:
+		w.Fr = v
+	case BackwordLeft:
+		w.Bl = v
+	default:
+		w.Br = v
+	}
+}
+
+// wheel picks the channel of the wheel from the four per-wheel channels.
+func wheel[T any](pos Position, fl, fr, bl, br T) T {
+	switch pos {
+	case ForwardLeft:
+		return fl
+	case ForwardRight:
+		return fr
+	case BackwordLeft:
+		return bl
+	}
+	return br
+}
+
+func (p *Packet) BrakeTemperature(pos Position) float32 {
+	return wheel(pos, p.VehicleBrakeTemperatureFl, p.VehicleBrakeTemperatureFr, p.VehicleBrakeTemperatureBl, p.VehicleBrakeTemperatureBr)
+}
+
+func (p *Packet) HubPosition(pos Position) float32 {
+	return wheel(pos, p.VehicleHubPositionFl, p.VehicleHubPositionFr, p.VehicleHubPositionBl, p.VehicleHubPositionBr)
+}
+
+func (p *Packet) HubVelocity(pos Position) float32 {
+	return wheel(pos, p.VehicleHubVelocityFl, p.VehicleHubVelocityFr, p.VehicleHubVelocityBl, p.VehicleHubVelocityBr)
+}
+
+func (p *Packet) CpForwardSpeed(pos Position) float32 {
+	return wheel(pos, p.VehicleCpForwardSpeedFl, p.VehicleCpForwardSpeedFr, p.VehicleCpForwardSpeedBl, p.VehicleCpForwardSpeedBr)
+}
+
+// TyreStateID returns the tyre state of the wheel, VehicleTyreState returns its name.
+func (p *Packet) TyreStateID(pos Position) uint8 {
+	return wheel(pos, p.VehicleTyreStateFl, p.VehicleTyreStateFr, p.VehicleTyreStateBl, p.VehicleTyreStateBr)
+}
@@ -0,0 +1,314 @@
+// Package pcap extracts telemetry datagrams from pcap and pcapng captures.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// link layer types.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkSLL      = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+)
+
+// pcapng block types.
+const (
+	blockSHB = 0x0a0d0d0a
+	blockIDB = 0x00000001
+	blockPB  = 0x00000002
+	blockSPB = 0x00000003
+	blockEPB = 0x00000006
+)
+
+// Limits of corrupt lengths, the largest snapshot length of libpcap and
+// the largest block Wireshark reads.
+const (
+	maxSnapLen = 262144
+	maxBlock   = 16 << 20
+)
+
+type iface struct {
+	link uint16
+	rate uint64 // timestamp units per second
+}
+
+// Reader returns the UDP payloads sent to a port in capture order.
+type Reader struct {
+	r      *bufio.Reader
+	port   uint16
+	ng     bool
+	order  binary.ByteOrder
+	nano   bool
+	link   uint16
+	ifaces []iface
+}
+
+// NewReader detects the capture format from the file header.
+func NewReader(r io.Reader, port int) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r), port: uint16(port)}
+	magic, err := rd.r.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case binary.LittleEndian.Uint32(magic) == blockSHB:
+		rd.ng = true
+		return rd, nil
+	case binary.LittleEndian.Uint32(magic) == 0xa1b2c3d4:
+		rd.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(magic) == 0xa1b2c3d4:
+		rd.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(magic) == 0xa1b23c4d:
+		rd.order, rd.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(magic) == 0xa1b23c4d:
+		rd.order, rd.nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("unknown capture format %x", magic)
+	}
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(rd.r, hdr); err != nil {
+		return nil, err
+	}
+	rd.link = uint16(rd.order.Uint32(hdr[20:]))
+	return rd, nil
+}
+
+// Next returns the capture time and UDP payload of the next matching datagram.
+func (r *Reader) Next() (time.Time, []byte, error) {
+	for {
+		var t time.Time
+		var link uint16
+		var frame []byte
+		var err error
+		if r.ng {
+			t, link, frame, err = r.nextBlock()
+		} else {
+			t, link, frame, err = r.nextRecord()
+		}
+		if err != nil {
+			return time.Time{}, nil, err
+		}
+		if frame == nil {
+			continue
+		}
+		if payload, ok := r.udp(link, frame); ok {
+			return t, payload, nil
+		}
+	}
+}
+
+// NextPacket returns the next datagram that decodes as a telemetry packet.
+func (r *Reader) NextPacket() (time.Time, *packet.Packet, error) {
+	for {
+		t, b, err := r.Next()
+		if err != nil {
+			return t, nil, err
+		}
+		p := packet.New()
+		if len(b) != p.Length() {
+			continue
+		}
+		if err := p.UnmarshalBinary(b); err != nil {
+			return t, nil, err
+		}
+		return t, p, nil
+	}
+}
+
+// truncated reports an end of file inside a record as io.ErrUnexpectedEOF
+// and passes other errors through.
+func truncated(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *Reader) nextRecord() (time.Time, uint16, []byte, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, hdr); err != nil {
+		return time.Time{}, 0, nil, err
+	}
+	sec := int64(r.order.Uint32(hdr[0:]))
+	frac := int64(r.order.Uint32(hdr[4:]))
+	if !r.nano {
+		frac *= 1000
+	}
+	n := r.order.Uint32(hdr[8:])
+	if n > maxSnapLen {
+		return time.Time{}, 0, nil, fmt.Errorf("invalid captured length %d", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r.r, frame); err != nil {
+		return time.Time{}, 0, nil, truncated(err)
+	}
+	return time.Unix(sec, frac), r.link, frame, nil
+}
+
+func (r *Reader) nextBlock() (time.Time, uint16, []byte, error) {
+	hdr := make([]byte, 8)
+	if _, err := io.ReadFull(r.r, hdr); err != nil {
+		return time.Time{}, 0, nil, err
+	}
+	if binary.LittleEndian.Uint32(hdr) == blockSHB {
+		// byte order magic follows the length and decides the order of the section.
+		bom, err := r.r.Peek(4)
+		if err != nil {
+			return time.Time{}, 0, nil, truncated(err)
+		}
+		r.order = binary.LittleEndian
+		if binary.BigEndian.Uint32(bom) == 0x1a2b3c4d {
+			r.order = binary.BigEndian
+		}
+		r.ifaces = r.ifaces[:0]
+	}
+	typ := r.order.Uint32(hdr[0:])
+	length := r.order.Uint32(hdr[4:])
+	if length < 12 || length%4 != 0 || length > maxBlock {
+		return time.Time{}, 0, nil, fmt.Errorf("invalid block length %d", length)
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return time.Time{}, 0, nil, truncated(err)
+	}
+	body = body[:len(body)-4]
+	switch typ {
+	case blockIDB:
+		if len(body) < 8 {
+			return time.Time{}, 0, nil, fmt.Errorf("invalid interface block")
+		}
+		ifc := iface{link: r.order.Uint16(body[0:]), rate: 1e6}
+		r.parseOptions(body[8:], &ifc)
+		r.ifaces = append(r.ifaces, ifc)
+	case blockEPB, blockPB:
+		if len(body) < 20 {
+			return time.Time{}, 0, nil, fmt.Errorf("invalid packet block")
+		}
+		id := uint32(r.order.Uint16(body[0:]))
+		if typ == blockEPB {
+			id = r.order.Uint32(body[0:])
+		}
+		if int(id) >= len(r.ifaces) {
+			return time.Time{}, 0, nil, fmt.Errorf("unknown interface %d", id)
+		}
+		ifc := r.ifaces[id]
+		ts := uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+		captured := r.order.Uint32(body[12:])
+		if int(captured) > len(body)-20 {
+			return time.Time{}, 0, nil, fmt.Errorf("invalid captured length %d", captured)
+		}
+		// frac < rate, so the product divided by rate cannot overflow
+		hi, lo := bits.Mul64(ts%ifc.rate, 1e9)
+		nsec, _ := bits.Div64(hi, lo, ifc.rate)
+		t := time.Unix(int64(ts/ifc.rate), int64(nsec))
+		return t, ifc.link, body[20 : 20+captured], nil
+	case blockSPB:
+		if len(r.ifaces) == 0 || len(body) < 4 {
+			return time.Time{}, 0, nil, fmt.Errorf("invalid simple packet block")
+		}
+		// simple packet blocks carry no timestamp.
+		return time.Time{}, r.ifaces[0].link, body[4:], nil
+	}
+	return time.Time{}, 0, nil, nil
+}
+
+func (r *Reader) parseOptions(b []byte, ifc *iface) {
+	for len(b) >= 4 {
+		code := r.order.Uint16(b[0:])
+		n := int(r.order.Uint16(b[2:]))
+		b = b[4:]
+		if code == 0 || n > len(b) {
+			return
+		}
+		if code == 9 && n >= 1 { // if_tsresol
+			v := b[0]
+			if v&0x80 != 0 && v&0x7f < 64 {
+				ifc.rate = 1 << (v & 0x7f)
+			} else if v&0x80 == 0 && v < 20 {
+				ifc.rate = 1
+				for i := 0; i < int(v); i++ {
+					ifc.rate *= 10
+				}
+			}
+		}
+		b = b[(n+3)&^3:]
+	}
+}
+
+// udp strips the link, network and transport headers.
+func (r *Reader) udp(link uint16, frame []byte) ([]byte, bool) {
+	var ip []byte
+	switch link {
+	default:
+		return nil, false
+	case linkNull, linkLoop:
+		if len(frame) < 4 {
+			return nil, false
+		}
+		ip = frame[4:]
+	case linkEthernet:
+		if len(frame) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(frame[12:])
+		ip = frame[14:]
+		for etherType == 0x8100 && len(ip) >= 4 { // 802.1Q
+			etherType = binary.BigEndian.Uint16(ip[2:])
+			ip = ip[4:]
+		}
+	case linkSLL:
+		if len(frame) < 16 {
+			return nil, false
+		}
+		ip = frame[16:]
+	case linkRaw, linkIPv4, linkIPv6:
+		ip = frame
+	}
+	if len(ip) < 1 {
+		return nil, false
+	}
+	var seg []byte
+	switch ip[0] >> 4 {
+	default:
+		return nil, false
+	case 4:
+		if len(ip) < 20 {
+			return nil, false
+		}
+		ihl := int(ip[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(ip[2:]))
+		frag := binary.BigEndian.Uint16(ip[6:])
+		if ip[9] != 17 || frag&0x3fff != 0 || ihl < 20 || total > len(ip) || ihl > total {
+			return nil, false
+		}
+		seg = ip[ihl:total]
+	case 6:
+		if len(ip) < 40 || ip[6] != 17 {
+			return nil, false
+		}
+		seg = ip[40:]
+	}
+	if len(seg) < 8 {
+		return nil, false
+	}
+	if binary.BigEndian.Uint16(seg[2:]) != r.port {
+		return nil, false
+	}
+	n := int(binary.BigEndian.Uint16(seg[4:]))
+	if n < 8 || n > len(seg) {
+		return nil, false
+	}
+	return seg[8:n], true
+}
@@ -0,0 +1,210 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+const port = 20777
+
+// udp4 returns an IPv4 datagram carrying payload from port 5000 to dst.
+func udp4(dst uint16, payload []byte) []byte {
+	b := make([]byte, 28+len(payload))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	b[8], b[9] = 64, 17
+	copy(b[12:], []byte{127, 0, 0, 1, 127, 0, 0, 1})
+	binary.BigEndian.PutUint16(b[20:], 5000)
+	binary.BigEndian.PutUint16(b[22:], dst)
+	binary.BigEndian.PutUint16(b[24:], uint16(8+len(payload)))
+	copy(b[28:], payload)
+	return b
+}
+
+func ethernet(vlan bool, ip []byte) []byte {
+	b := make([]byte, 12)
+	if vlan {
+		b = append(b, 0x81, 0x00, 0x00, 0x05)
+	}
+	b = append(b, 0x08, 0x00)
+	return append(b, ip...)
+}
+
+func sll(ip []byte) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint16(b[14:], 0x0800)
+	return append(b, ip...)
+}
+
+type record struct {
+	time  time.Time
+	frame []byte
+}
+
+func pcapFile(order binary.ByteOrder, nano bool, link uint32, records []record) []byte {
+	buf := &bytes.Buffer{}
+	magic := uint32(0xa1b2c3d4)
+	if nano {
+		magic = 0xa1b23c4d
+	}
+	binary.Write(buf, order, []uint32{magic, 0x00040002, 0, 0, 65535, link})
+	for _, rec := range records {
+		frac := uint32(rec.time.Nanosecond())
+		if !nano {
+			frac /= 1000
+		}
+		n := uint32(len(rec.frame))
+		binary.Write(buf, order, []uint32{uint32(rec.time.Unix()), frac, n, n})
+		buf.Write(rec.frame)
+	}
+	return buf.Bytes()
+}
+
+func block(buf *bytes.Buffer, order binary.ByteOrder, typ uint32, body []byte) {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	n := uint32(12 + len(body))
+	binary.Write(buf, order, []uint32{typ, n})
+	buf.Write(body)
+	binary.Write(buf, order, n)
+}
+
+// pcapngFile writes one section with one interface. A tsresol of 0 omits the option.
+func pcapngFile(order binary.ByteOrder, link uint16, tsresol byte, records []record) []byte {
+	buf := &bytes.Buffer{}
+	shb := &bytes.Buffer{}
+	binary.Write(shb, order, uint32(0x1a2b3c4d))
+	binary.Write(shb, order, []uint16{1, 0})
+	binary.Write(shb, order, int64(-1))
+	block(buf, order, blockSHB, shb.Bytes())
+	idb := &bytes.Buffer{}
+	binary.Write(idb, order, []uint16{link, 0})
+	binary.Write(idb, order, uint32(65535))
+	scale := uint64(1000)
+	if tsresol != 0 {
+		binary.Write(idb, order, []uint16{9, 1})
+		idb.Write([]byte{tsresol, 0, 0, 0})
+		binary.Write(idb, order, []uint16{0, 0})
+		scale = 1
+		for i := byte(0); i < 9-tsresol; i++ {
+			scale *= 10
+		}
+	}
+	block(buf, order, blockIDB, idb.Bytes())
+	for _, rec := range records {
+		ts := uint64(rec.time.UnixNano()) / scale
+		n := uint32(len(rec.frame))
+		epb := &bytes.Buffer{}
+		binary.Write(epb, order, []uint32{0, uint32(ts >> 32), uint32(ts), n, n})
+		epb.Write(rec.frame)
+		block(buf, order, blockEPB, epb.Bytes())
+	}
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	base := time.Unix(1700000000, 123456789)
+	payloads := [][]byte{[]byte("first"), []byte("second")}
+	frames := func(wrap func([]byte) []byte) []record {
+		return []record{
+			{base, wrap(udp4(port, payloads[0]))},
+			{base.Add(time.Second), wrap(udp4(port+1, []byte("other port")))},
+			{base.Add(2 * time.Second), wrap(udp4(port, payloads[1]))},
+		}
+	}
+	eth := func(ip []byte) []byte { return ethernet(false, ip) }
+	vlan := func(ip []byte) []byte { return ethernet(true, ip) }
+	raw := func(ip []byte) []byte { return ip }
+	for _, tc := range []struct {
+		name string
+		data []byte
+		res  time.Duration
+	}{
+		{"pcap le", pcapFile(binary.LittleEndian, false, linkEthernet, frames(eth)), time.Microsecond},
+		{"pcap be vlan", pcapFile(binary.BigEndian, false, linkEthernet, frames(vlan)), time.Microsecond},
+		{"pcap ns sll", pcapFile(binary.LittleEndian, true, linkSLL, frames(sll)), time.Nanosecond},
+		{"pcapng le", pcapngFile(binary.LittleEndian, linkEthernet, 0, frames(eth)), time.Microsecond},
+		{"pcapng be tsresol", pcapngFile(binary.BigEndian, linkRaw, 9, frames(raw)), time.Nanosecond},
+		{"pcapng ms vlan", pcapngFile(binary.LittleEndian, linkEthernet, 3, frames(vlan)), time.Millisecond},
+	} {
+		r, err := NewReader(bytes.NewReader(tc.data), port)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for i, want := range payloads {
+			ts, b, err := r.Next()
+			if err != nil {
+				t.Fatalf("%s: datagram %d: %v", tc.name, i, err)
+			}
+			if !bytes.Equal(b, want) {
+				t.Errorf("%s: datagram %d = %q, want %q", tc.name, i, b, want)
+			}
+			wantTime := base.Add(time.Duration(2*i) * time.Second).Truncate(tc.res)
+			if !ts.Equal(wantTime) {
+				t.Errorf("%s: datagram %d time %v, want %v", tc.name, i, ts, wantTime)
+			}
+		}
+		if _, _, err := r.Next(); err != io.EOF {
+			t.Errorf("%s: end %v, want EOF", tc.name, err)
+		}
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	data := pcapFile(binary.LittleEndian, false, linkRaw, []record{{time.Unix(1, 0), udp4(port, []byte("x"))}})
+	r, err := NewReader(bytes.NewReader(data[:len(data)-3]), port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReaderCorruptLength(t *testing.T) {
+	pcap := pcapFile(binary.LittleEndian, false, linkRaw, []record{{time.Unix(1, 0), udp4(port, []byte("x"))}})
+	binary.LittleEndian.PutUint32(pcap[24+8:], 0xfffffff0)
+	ng := pcapngFile(binary.LittleEndian, linkRaw, 0, []record{{time.Unix(1, 0), udp4(port, []byte("x"))}})
+	// the length of the interface block following the section header
+	shb := binary.LittleEndian.Uint32(ng[4:])
+	binary.LittleEndian.PutUint32(ng[shb+4:], 0xfffffff0)
+	for name, data := range map[string][]byte{"pcap": pcap, "pcapng": ng} {
+		r, err := NewReader(bytes.NewReader(data), port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := r.Next(); err == nil || err == io.ErrUnexpectedEOF {
+			t.Errorf("%s: got %v, want an invalid length error", name, err)
+		}
+	}
+}
+
+type failing struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failing) Read(b []byte) (int, error) {
+	n, err := f.r.Read(b)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestReaderError(t *testing.T) {
+	want := errors.New("disk failure")
+	data := pcapFile(binary.LittleEndian, false, linkRaw, nil)
+	r, err := NewReader(&failing{bytes.NewReader(data), want}, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Next(); err != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
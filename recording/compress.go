@@ -0,0 +1,532 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// CompressedMagic starts every compressed recording.
+const CompressedMagic = "WRCZ"
+
+// BlockSize is the number of records per compressed block.
+const BlockSize = 512
+
+const compressedVersion = 1
+
+// maxBlockLength bounds the block length of corrupt files: a block of the
+// largest datagrams with room for the coding.
+const maxBlockLength = 2 * BlockSize * maxDatagram
+
+// column is the position of a channel in the datagram.
+type column struct {
+	key    string
+	offset int
+	size   int
+	typ    string
+}
+
+// newColumns lays out the channels in order and returns the columns and
+// the update datagram size.
+func newColumns(keys, types []string) ([]column, int, error) {
+	columns := []column{}
+	offset := 0
+	for i, key := range keys {
+		size := 0
+		switch types[i] {
+		default:
+			return nil, 0, fmt.Errorf("type %s of channel %s not supported", types[i], key)
+		case "boolean", "uint8":
+			size = 1
+		case "uint16":
+			size = 2
+		case "float32", "fourcc":
+			size = 4
+		case "float64", "uint64":
+			size = 8
+		}
+		columns = append(columns, column{key: key, offset: offset, size: size, typ: types[i]})
+		offset += size
+	}
+	return columns, offset, nil
+}
+
+// layout returns the columns of the update datagram of the current packet structure.
+func layout() ([]column, int, error) {
+	keys := packet.New().Fields()
+	types := make([]string, len(keys))
+	for i, key := range keys {
+		ch, ok := packet.ChannelDicts[key]
+		if !ok {
+			return nil, 0, fmt.Errorf("channel %s not found", key)
+		}
+		types[i] = ch.Type
+	}
+	return newColumns(keys, types)
+}
+
+// maxColumns and maxName bound the header of corrupt files.
+const (
+	maxColumns = 1024
+	maxName    = 256
+)
+
+// writeColumns writes the column count and the channel ID and type of
+// every column, each as a uvarint length and the bytes.
+func writeColumns(w *bytes.Buffer, columns []column) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	put := func(s string) {
+		w.Write(tmp[:binary.PutUvarint(tmp, uint64(len(s)))])
+		w.WriteString(s)
+	}
+	w.Write(tmp[:binary.PutUvarint(tmp, uint64(len(columns)))])
+	for _, c := range columns {
+		put(c.key)
+		put(c.typ)
+	}
+}
+
+// readColumns reads what writeColumns wrote and returns the header length.
+func readColumns(r *bufio.Reader) ([]column, int, int64, error) {
+	read := int64(0)
+	uvarint := func() (uint64, error) {
+		v, err := binary.ReadUvarint(r)
+		if err == nil {
+			read += int64(len(binary.AppendUvarint(nil, v)))
+		}
+		return v, err
+	}
+	get := func() (string, error) {
+		n, err := uvarint()
+		if err != nil {
+			return "", err
+		}
+		if n > maxName {
+			return "", fmt.Errorf("invalid column name length %d", n)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", io.ErrUnexpectedEOF
+		}
+		read += int64(n)
+		return string(b), nil
+	}
+	n, err := uvarint()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if n > maxColumns {
+		return nil, 0, 0, fmt.Errorf("invalid column count %d", n)
+	}
+	keys := make([]string, n)
+	types := make([]string, n)
+	for i := range keys {
+		if keys[i], err = get(); err != nil {
+			return nil, 0, 0, err
+		}
+		if types[i], err = get(); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	columns, size, err := newColumns(keys, types)
+	return columns, size, read, err
+}
+
+func (c column) get(b []byte) uint64 {
+	switch c.size {
+	case 1:
+		return uint64(b[c.offset])
+	case 2:
+		return uint64(endian.Uint16(b[c.offset:]))
+	case 4:
+		return uint64(endian.Uint32(b[c.offset:]))
+	}
+	return endian.Uint64(b[c.offset:])
+}
+
+func (c column) set(b []byte, v uint64) {
+	switch c.size {
+	case 1:
+		b[c.offset] = byte(v)
+	case 2:
+		endian.PutUint16(b[c.offset:], uint16(v))
+	case 4:
+		endian.PutUint32(b[c.offset:], uint32(v))
+	default:
+		endian.PutUint64(b[c.offset:], v)
+	}
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// encode turns a column into words that are zero while the channel is steady:
+// floats and fourcc are XORed with the previous value, small integers are
+// delta coded and uint64 counters are delta-of-delta coded.
+func (c column) encode(values []uint64) []uint64 {
+	words := make([]uint64, len(values))
+	var prev, prevDelta uint64
+	for i, v := range values {
+		switch c.typ {
+		case "float32", "float64", "fourcc":
+			words[i] = v ^ prev
+		case "uint64":
+			d := v - prev
+			words[i] = zigzag(int64(d - prevDelta))
+			prevDelta = d
+		default:
+			words[i] = zigzag(int64(v - prev))
+		}
+		prev = v
+	}
+	return words
+}
+
+func (c column) decode(words []uint64) []uint64 {
+	values := make([]uint64, len(words))
+	var prev, prevDelta uint64
+	for i, w := range words {
+		switch c.typ {
+		case "float32", "float64", "fourcc":
+			prev ^= w
+		case "uint64":
+			prevDelta += uint64(unzigzag(w))
+			prev += prevDelta
+		default:
+			prev += uint64(unzigzag(w))
+		}
+		values[i] = prev
+	}
+	return values
+}
+
+// putWords writes words as uvarints with runs of zeros as a zero and the run length.
+func putWords(buf *bytes.Buffer, words []uint64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for i := 0; i < len(words); {
+		w := words[i]
+		if w != 0 {
+			buf.Write(tmp[:binary.PutUvarint(tmp, w)])
+			i++
+			continue
+		}
+		n := 1
+		for i+n < len(words) && words[i+n] == 0 {
+			n++
+		}
+		buf.WriteByte(0)
+		buf.Write(tmp[:binary.PutUvarint(tmp, uint64(n-1))])
+		i += n
+	}
+}
+
+func getWords(r *bytes.Reader, n int) ([]uint64, error) {
+	words := make([]uint64, 0, n)
+	for len(words) < n {
+		w, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if w != 0 {
+			words = append(words, w)
+			continue
+		}
+		run, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if run >= uint64(n-len(words)) {
+			return nil, fmt.Errorf("invalid run length %d", run+1)
+		}
+		for i := uint64(0); i <= run; i++ {
+			words = append(words, 0)
+		}
+	}
+	return words, nil
+}
+
+// CompressedWriter writes a compressed recording: the magic, a uint16 version,
+// the channel ID and type of every column of the update datagrams and a
+// sequence of blocks, each a uint32 length followed by the block body.
+// A block body holds the record count, the times, the datagram sizes,
+// the update datagrams column by column and other datagrams verbatim.
+// Close appends the index.
+type CompressedWriter struct {
+	w       *bufio.Writer
+	header  bool
+	columns []column
+	size    int
+	records []*Record
+	written int64
+	index   indexer
+}
+
+func NewCompressedWriter(w io.Writer) *CompressedWriter {
+	return &CompressedWriter{w: bufio.NewWriter(w)}
+}
+
+func (w *CompressedWriter) WriteData(t time.Time, b []byte) error {
+	if !w.header {
+		columns, size, err := layout()
+		if err != nil {
+			return err
+		}
+		w.columns, w.size = columns, size
+		w.header = true
+		head := bytes.NewBufferString(CompressedMagic)
+		binary.Write(head, endian, uint16(compressedVersion))
+		writeColumns(head, columns)
+		n, err := head.WriteTo(w.w)
+		if err != nil {
+			return err
+		}
+		w.written = n
+	}
+	rec := &Record{Time: t, Data: append([]byte(nil), b...)}
+	w.index.add(Position{Offset: w.written, Skip: len(w.records)}, rec)
+	w.records = append(w.records, rec)
+	if len(w.records) >= BlockSize {
+		return w.writeBlock()
+	}
+	return nil
+}
+
+func (w *CompressedWriter) Write(t time.Time, p *packet.Packet) error {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.WriteData(t, b)
+}
+
+func (w *CompressedWriter) writeBlock() error {
+	if len(w.records) == 0 {
+		return nil
+	}
+	buf := bytes.NewBuffer(nil)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	buf.Write(tmp[:binary.PutUvarint(tmp, uint64(len(w.records)))])
+	times := make([]uint64, len(w.records))
+	sizes := make([]uint64, len(w.records))
+	updates := [][]byte{}
+	for i, rec := range w.records {
+		times[i] = uint64(rec.Time.UnixNano())
+		sizes[i] = uint64(len(rec.Data))
+		if len(rec.Data) == w.size {
+			updates = append(updates, rec.Data)
+		}
+	}
+	putWords(buf, column{typ: "uint64"}.encode(times))
+	putWords(buf, column{typ: "uint16"}.encode(sizes))
+	values := make([]uint64, len(updates))
+	for _, c := range w.columns {
+		for i, b := range updates {
+			values[i] = c.get(b)
+		}
+		putWords(buf, c.encode(values))
+	}
+	for _, rec := range w.records {
+		if len(rec.Data) != w.size {
+			buf.Write(rec.Data)
+		}
+	}
+	w.records = w.records[:0]
+	binary.Write(w.w, endian, uint32(buf.Len()))
+	n, err := buf.WriteTo(w.w)
+	w.written += 4 + n
+	return err
+}
+
+// Flush writes the pending records as a block. Call it when the recording ends,
+// flushing often makes the blocks smaller and the compression worse.
+func (w *CompressedWriter) Flush() error {
+	if err := w.writeBlock(); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// Close writes the pending records and the index and flushes.
+// It does not close the underlying writer.
+func (w *CompressedWriter) Close() error {
+	if !w.header {
+		return w.Flush()
+	}
+	if err := w.writeBlock(); err != nil {
+		return err
+	}
+	if err := writeIndex(w.w, w.written, &w.index.index); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+type CompressedReader struct {
+	r       *bufio.Reader
+	header  bool
+	err     error // of the header
+	columns []column
+	size    int
+	records []*Record
+	block   int64 // offset of the current block
+	count   int   // records in the current block
+	offset  int64 // offset of the next block
+}
+
+func NewCompressedReader(r io.Reader) *CompressedReader {
+	return &CompressedReader{r: bufio.NewReader(r)}
+}
+
+func (r *CompressedReader) readHeader() error {
+	var head struct {
+		Magic   [4]byte
+		Version uint16
+	}
+	if err := binary.Read(r.r, endian, &head); err != nil {
+		return err
+	}
+	if string(head.Magic[:]) != CompressedMagic {
+		return fmt.Errorf("invalid magic %q", head.Magic[:])
+	}
+	if head.Version != compressedVersion {
+		return fmt.Errorf("unsupported version %d", head.Version)
+	}
+	columns, size, n, err := readColumns(r.r)
+	if err != nil {
+		return err
+	}
+	r.columns, r.size = columns, size
+	r.startAt(int64(len(CompressedMagic)) + 2 + n)
+	return nil
+}
+
+// init reads the header once.
+func (r *CompressedReader) init() error {
+	if !r.header && r.err == nil {
+		r.err = r.readHeader()
+	}
+	return r.err
+}
+
+// startAt marks the reader as positioned on a block at offset.
+// The columns must be set.
+func (r *CompressedReader) startAt(offset int64) {
+	r.header = true
+	r.offset = offset
+}
+
+// Position returns the position of the next record.
+func (r *CompressedReader) Position() Position {
+	if r.init() != nil {
+		return Position{}
+	}
+	if len(r.records) == 0 {
+		return Position{Offset: r.offset}
+	}
+	return Position{Offset: r.block, Skip: r.count - len(r.records)}
+}
+
+func (r *CompressedReader) readBlock() error {
+	var length uint32
+	if err := binary.Read(r.r, endian, &length); err != nil {
+		return err
+	}
+	if length == endMarker {
+		return io.EOF
+	}
+	if length > maxBlockLength {
+		return fmt.Errorf("invalid block length %d", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	records, err := r.decodeBlock(body)
+	if err != nil {
+		return err
+	}
+	r.records = records
+	r.block, r.count = r.offset, len(records)
+	r.offset += 4 + int64(length)
+	return nil
+}
+
+func (r *CompressedReader) decodeBlock(body []byte) ([]*Record, error) {
+	br := bytes.NewReader(body)
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 || n > BlockSize {
+		return nil, fmt.Errorf("invalid block count %d", n)
+	}
+	words, err := getWords(br, int(n))
+	if err != nil {
+		return nil, err
+	}
+	times := column{typ: "uint64"}.decode(words)
+	if words, err = getWords(br, int(n)); err != nil {
+		return nil, err
+	}
+	sizes := column{typ: "uint16"}.decode(words)
+	// datagrams other than updates are stored verbatim and must fit in the block
+	verbatim := uint64(0)
+	for _, size := range sizes {
+		if size != uint64(r.size) {
+			verbatim += size
+		}
+		if size > maxDatagram || verbatim > uint64(len(body)) {
+			return nil, fmt.Errorf("invalid datagram size %d", size)
+		}
+	}
+	records := make([]*Record, n)
+	updates := [][]byte{}
+	for i := range records {
+		records[i] = &Record{Time: time.Unix(0, int64(times[i])), Data: make([]byte, sizes[i])}
+		if int(sizes[i]) == r.size {
+			updates = append(updates, records[i].Data)
+		}
+	}
+	for _, c := range r.columns {
+		words, err := getWords(br, len(updates))
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range c.decode(words) {
+			c.set(updates[i], v)
+		}
+	}
+	for _, rec := range records {
+		if len(rec.Data) != r.size {
+			if _, err := io.ReadFull(br, rec.Data); err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+		}
+	}
+	return records, nil
+}
+
+// Next returns the next record or io.EOF at the end of the recording.
+func (r *CompressedReader) Next() (*Record, error) {
+	if err := r.init(); err != nil {
+		return nil, err
+	}
+	for len(r.records) == 0 {
+		if err := r.readBlock(); err != nil {
+			return nil, err
+		}
+	}
+	rec := r.records[0]
+	r.records = r.records[1:]
+	return rec, nil
+}
@@ -0,0 +1,397 @@
+package recording
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// IndexMagic ends a recording that carries an index.
+const IndexMagic = "WRCI"
+
+// endMarker replaces the record or block length to end the records before the index.
+const endMarker = 0xffffffff
+
+// CheckpointInterval is the GameTotalTime in seconds between checkpoints.
+const CheckpointInterval = 1.0
+
+// Position locates a record: the byte offset of the record, or of the block
+// for compressed recordings, and the number of records to skip from there.
+type Position struct {
+	Offset int64 `json:"offset"`
+	Skip   int   `json:"skip"`
+}
+
+// Checkpoint is a seekable record with the times and distance it was received at.
+type Checkpoint struct {
+	Position             Position `json:"position"`
+	Stage                int      `json:"stage"`
+	GameTotalTime        float32  `json:"game_total_time"`
+	StageCurrentTime     float32  `json:"stage_current_time"`
+	StageCurrentDistance float64  `json:"stage_current_distance"`
+}
+
+// Stage is a continuous run on one route between restarts or route changes.
+type Stage struct {
+	RouteID       uint16  `json:"route_id"`
+	Route         string  `json:"route"`
+	LocationID    uint16  `json:"location_id"`
+	Location      string  `json:"location"`
+	VehicleID     uint16  `json:"vehicle_id"`
+	Vehicle       string  `json:"vehicle"`
+	GameMode      uint8   `json:"game_mode"`
+	StageLength   float64 `json:"stage_length"`
+	StartGameTime float32 `json:"start_game_time"`
+	EndGameTime   float32 `json:"end_game_time"`
+	EndStageTime  float32 `json:"end_stage_time"`
+	EndDistance   float64 `json:"end_distance"`
+	Records       int     `json:"records"`
+	// FirstCheckpoint and LastCheckpoint are the range of Index.Checkpoints in this stage.
+	FirstCheckpoint int `json:"first_checkpoint"`
+	LastCheckpoint  int `json:"last_checkpoint"`
+}
+
+type Index struct {
+	Stages      []*Stage     `json:"stages"`
+	Checkpoints []Checkpoint `json:"checkpoints"`
+}
+
+// indexer builds the index while records are written or scanned.
+type indexer struct {
+	index  Index
+	last   *packet.Packet
+	stage  *Stage
+	lastCP float32
+}
+
+func (x *indexer) add(pos Position, rec *Record) {
+	p := packet.New()
+	if len(rec.Data) != p.Length() || p.UnmarshalBinary(rec.Data) != nil {
+		return
+	}
+	last := x.last
+	x.last = p
+	restart := last != nil && p.Restarted(last.StageCurrentTime, packet.RestartTolerance)
+	if x.stage == nil || restart || p.RouteID != x.stage.RouteID ||
+		p.VehicleID != x.stage.VehicleID || p.GameMode != x.stage.GameMode {
+		x.stage = &Stage{
+			RouteID:         p.RouteID,
+			Route:           p.Route(),
+			LocationID:      p.LocationID,
+			Location:        p.Location(),
+			VehicleID:       p.VehicleID,
+			Vehicle:         p.Vehicle(),
+			GameMode:        p.GameMode,
+			StageLength:     p.StageLength,
+			StartGameTime:   p.GameTotalTime,
+			FirstCheckpoint: len(x.index.Checkpoints),
+		}
+		x.index.Stages = append(x.index.Stages, x.stage)
+		last = nil
+	}
+	s := x.stage
+	s.EndGameTime = p.GameTotalTime
+	s.EndStageTime = p.StageCurrentTime
+	s.EndDistance = p.StageCurrentDistance
+	s.Records++
+	if last == nil || p.GameTotalTime-x.lastCP >= CheckpointInterval || p.GameTotalTime < x.lastCP {
+		x.lastCP = p.GameTotalTime
+		x.index.Checkpoints = append(x.index.Checkpoints, Checkpoint{
+			Position:             pos,
+			Stage:                len(x.index.Stages) - 1,
+			GameTotalTime:        p.GameTotalTime,
+			StageCurrentTime:     p.StageCurrentTime,
+			StageCurrentDistance: p.StageCurrentDistance,
+		})
+	}
+	s.LastCheckpoint = len(x.index.Checkpoints) - 1
+}
+
+// writeIndex writes the end marker, the index as JSON and the footer
+// holding the uint64 offset of the JSON and IndexMagic.
+func writeIndex(w io.Writer, offset int64, index *Index) error {
+	if err := binary.Write(w, endian, uint32(endMarker)); err != nil {
+		return err
+	}
+	b, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if err := binary.Write(w, endian, uint64(offset+4)); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, IndexMagic)
+	return err
+}
+
+// ErrNoIndex is returned by ReadIndex for recordings written without Close.
+var ErrNoIndex = errors.New("recording has no index")
+
+// ReadIndex reads the index stored at the end of a recording.
+func ReadIndex(rs io.ReadSeeker) (*Index, error) {
+	end, err := rs.Seek(-12, io.SeekEnd)
+	if err != nil {
+		return nil, ErrNoIndex
+	}
+	var footer struct {
+		Offset uint64
+		Magic  [4]byte
+	}
+	if err := binary.Read(rs, endian, &footer); err != nil {
+		return nil, err
+	}
+	if string(footer.Magic[:]) != IndexMagic || int64(footer.Offset) > end {
+		return nil, ErrNoIndex
+	}
+	if _, err := rs.Seek(int64(footer.Offset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	index := &Index{}
+	if err := json.NewDecoder(io.LimitReader(rs, end-int64(footer.Offset))).Decode(index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// File is a recording opened for random access.
+type File struct {
+	Index *Index
+
+	rs         io.ReadSeeker
+	compressed bool
+	columns    []column // of a compressed recording
+	size       int
+}
+
+// NewFile reads the index of a recording, or builds it by scanning
+// the recording when it was written without one.
+func NewFile(rs io.ReadSeeker) (*File, error) {
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(rs, magic); err != nil {
+		return nil, err
+	}
+	f := &File{rs: rs}
+	switch string(magic) {
+	default:
+		return nil, fmt.Errorf("invalid magic %q", magic)
+	case Magic:
+	case CompressedMagic:
+		f.compressed = true
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		cr := NewCompressedReader(rs)
+		if err := cr.init(); err != nil {
+			return nil, err
+		}
+		f.columns, f.size = cr.columns, cr.size
+	}
+	index, err := ReadIndex(rs)
+	if errors.Is(err, ErrNoIndex) {
+		index, err = f.scan()
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Index = index
+	return f, nil
+}
+
+// OpenFile opens a recording for random access. Close the returned *os.File when done.
+func OpenFile(name string) (*File, *os.File, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := NewFile(fp)
+	if err != nil {
+		fp.Close()
+		return nil, nil, err
+	}
+	return f, fp, nil
+}
+
+type positionReader interface {
+	RecordReader
+	Position() Position
+}
+
+func (f *File) scan() (*Index, error) {
+	if _, err := f.rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var r positionReader = NewReader(f.rs)
+	if f.compressed {
+		r = NewCompressedReader(f.rs)
+	}
+	x := &indexer{}
+	for {
+		pos := r.Position()
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		x.add(pos, rec)
+	}
+	return &x.index, nil
+}
+
+// Stages returns the stages contained in the recording.
+func (f *File) Stages() []*Stage {
+	return f.Index.Stages
+}
+
+// seekReader returns the pending record first.
+type seekReader struct {
+	RecordReader
+	pending *Record
+}
+
+func (r *seekReader) Next() (*Record, error) {
+	if r.pending != nil {
+		rec := r.pending
+		r.pending = nil
+		return rec, nil
+	}
+	return r.RecordReader.Next()
+}
+
+// seek reads from the checkpoint cp until reached reports the record was found.
+// The returned reader starts with that record.
+func (f *File) seek(cp int, reached func(p *packet.Packet) bool) (RecordReader, error) {
+	if cp < 0 || cp >= len(f.Index.Checkpoints) {
+		return nil, fmt.Errorf("checkpoint %d out of range", cp)
+	}
+	pos := f.Index.Checkpoints[cp].Position
+	if _, err := f.rs.Seek(pos.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var r RecordReader
+	if f.compressed {
+		cr := NewCompressedReader(f.rs)
+		cr.columns, cr.size = f.columns, f.size
+		cr.startAt(pos.Offset)
+		r = cr
+	} else {
+		rr := NewReader(f.rs)
+		rr.startAt(pos.Offset)
+		r = rr
+	}
+	for i := 0; i < pos.Skip; i++ {
+		if _, err := r.Next(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		rec, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		p, err := rec.Packet()
+		if err != nil {
+			continue
+		}
+		if reached(p) {
+			return &seekReader{RecordReader: r, pending: rec}, nil
+		}
+	}
+}
+
+func (f *File) stage(stage int) (*Stage, error) {
+	if stage < 0 || stage >= len(f.Index.Stages) {
+		return nil, fmt.Errorf("stage %d out of range", stage)
+	}
+	return f.Index.Stages[stage], nil
+}
+
+// SeekGameTime returns a reader starting at the first record at or after GameTotalTime t.
+func (f *File) SeekGameTime(t float32) (RecordReader, error) {
+	cp := 0
+	for i, c := range f.Index.Checkpoints {
+		if c.GameTotalTime <= t {
+			cp = i
+		}
+	}
+	return f.seek(cp, func(p *packet.Packet) bool {
+		return p.GameTotalTime >= t
+	})
+}
+
+// SeekStageTime returns a reader starting at the first record of the stage
+// at or after StageCurrentTime t.
+func (f *File) SeekStageTime(stage int, t float32) (RecordReader, error) {
+	s, err := f.stage(stage)
+	if err != nil {
+		return nil, err
+	}
+	if t > s.EndStageTime {
+		return nil, fmt.Errorf("stage time %g beyond stage end %g", t, s.EndStageTime)
+	}
+	cp := s.FirstCheckpoint
+	for i := s.FirstCheckpoint; i <= s.LastCheckpoint; i++ {
+		if f.Index.Checkpoints[i].StageCurrentTime <= t {
+			cp = i
+		}
+	}
+	return f.seek(cp, func(p *packet.Packet) bool {
+		return p.StageCurrentTime >= t
+	})
+}
+
+// SeekDistance returns a reader starting at the first record of the stage
+// at or after StageCurrentDistance d.
+func (f *File) SeekDistance(stage int, d float64) (RecordReader, error) {
+	s, err := f.stage(stage)
+	if err != nil {
+		return nil, err
+	}
+	if d > s.EndDistance {
+		return nil, fmt.Errorf("distance %g beyond stage end %g", d, s.EndDistance)
+	}
+	cp := s.FirstCheckpoint
+	for i := s.FirstCheckpoint; i <= s.LastCheckpoint; i++ {
+		if f.Index.Checkpoints[i].StageCurrentDistance >= d {
+			break
+		}
+		cp = i
+	}
+	return f.seek(cp, func(p *packet.Packet) bool {
+		return p.StageCurrentDistance >= d
+	})
+}
+
+// StagePackets returns the update packets of a stage.
+func (f *File) StagePackets(stage int) ([]*packet.Packet, error) {
+	s, err := f.stage(stage)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.seek(s.FirstCheckpoint, func(p *packet.Packet) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	packets := make([]*packet.Packet, 0, s.Records)
+	for len(packets) < s.Records {
+		rec, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		p, err := rec.Packet()
+		if err != nil {
+			continue
+		}
+		packets = append(packets, p)
+	}
+	return packets, nil
+}
@@ -0,0 +1,191 @@
+// Package recording stores received telemetry datagrams with their receive time.
+package recording
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// Magic starts every raw recording.
+const Magic = "WRCR"
+
+const version = 1
+
+// maxDatagram bounds the record length of corrupt files, the largest UDP payload.
+const maxDatagram = 65535
+
+var endian = binary.LittleEndian
+
+// Record is one datagram as received.
+type Record struct {
+	Time time.Time
+	Data []byte
+}
+
+// Packet decodes the datagram.
+func (r *Record) Packet() (*packet.Packet, error) {
+	p := packet.New()
+	if err := p.UnmarshalBinary(r.Data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Writer writes a raw recording: the magic, a uint16 version and then
+// for each record a uint32 length, int64 unix nanoseconds and the datagram.
+// Close appends the index.
+type Writer struct {
+	w       *bufio.Writer
+	header  bool
+	written int64
+	index   indexer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) WriteData(t time.Time, b []byte) error {
+	if !w.header {
+		w.header = true
+		w.w.WriteString(Magic)
+		binary.Write(w.w, endian, uint16(version))
+		w.written = int64(len(Magic)) + 2
+	}
+	rec := &Record{Time: t, Data: b}
+	w.index.add(Position{Offset: w.written}, rec)
+	binary.Write(w.w, endian, uint32(len(b)))
+	binary.Write(w.w, endian, t.UnixNano())
+	_, err := w.w.Write(b)
+	w.written += 12 + int64(len(b))
+	return err
+}
+
+func (w *Writer) Write(t time.Time, p *packet.Packet) error {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.WriteData(t, b)
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Close writes the index and flushes. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if !w.header {
+		return w.Flush()
+	}
+	if err := writeIndex(w.w, w.written, &w.index.index); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+type Reader struct {
+	r      *bufio.Reader
+	header bool
+	offset int64
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// startAt marks the reader as positioned on a record at offset.
+func (r *Reader) startAt(offset int64) {
+	r.header = true
+	r.offset = offset
+}
+
+func (r *Reader) readHeader() error {
+	var head struct {
+		Magic   [4]byte
+		Version uint16
+	}
+	if err := binary.Read(r.r, endian, &head); err != nil {
+		return err
+	}
+	if string(head.Magic[:]) != Magic {
+		return fmt.Errorf("invalid magic %q", head.Magic[:])
+	}
+	if head.Version != version {
+		return fmt.Errorf("unsupported version %d", head.Version)
+	}
+	r.header = true
+	r.offset = int64(len(Magic)) + 2
+	return nil
+}
+
+// Position returns the position of the next record.
+func (r *Reader) Position() Position {
+	if !r.header {
+		return Position{Offset: int64(len(Magic)) + 2}
+	}
+	return Position{Offset: r.offset}
+}
+
+// Next returns the next record or io.EOF at the end of the recording.
+func (r *Reader) Next() (*Record, error) {
+	if !r.header {
+		if err := r.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+	var length uint32
+	if err := binary.Read(r.r, endian, &length); err != nil {
+		return nil, err
+	}
+	if length == endMarker {
+		return nil, io.EOF
+	}
+	var ts int64
+	if err := binary.Read(r.r, endian, &ts); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if length > maxDatagram {
+		return nil, fmt.Errorf("invalid record length %d", length)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r.offset += 12 + int64(length)
+	return &Record{Time: time.Unix(0, ts), Data: b}, nil
+}
+
+// RecordReader is implemented by Reader and CompressedReader.
+type RecordReader interface {
+	Next() (*Record, error)
+}
+
+// RecordWriter is implemented by Writer and CompressedWriter.
+type RecordWriter interface {
+	WriteData(t time.Time, b []byte) error
+	Write(t time.Time, p *packet.Packet) error
+	Flush() error
+	Close() error
+}
+
+// Open returns a reader for a raw or compressed recording detected by its magic.
+func Open(r io.Reader) (RecordReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(Magic))
+	if err != nil {
+		return nil, err
+	}
+	switch string(magic) {
+	case Magic:
+		return NewReader(br), nil
+	case CompressedMagic:
+		return NewCompressedReader(br), nil
+	}
+	return nil, fmt.Errorf("invalid magic %q", magic)
+}
@@ -0,0 +1,243 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+func roundTrip(t *testing.T, w RecordWriter, buf *bytes.Buffer) {
+	t.Helper()
+	check(t, buf, write(t, w))
+}
+
+func write(t *testing.T, w RecordWriter) []*Record {
+	t.Helper()
+	base := time.Unix(1700000000, 0)
+	want := []*Record{}
+	for i := 0; i < BlockSize+10; i++ {
+		p := packet.New()
+		p.Packet4CC = [4]byte([]byte("sesu"))
+		p.PacketUID = uint64(i)
+		p.GameTotalTime = float32(i) / 60
+		p.StageCurrentTime = float32(i%300) / 60
+		p.GameFrameCount = uint64(i * 2)
+		p.VehicleSpeed = float32(i) * 0.37
+		p.StageCurrentDistance = float64(i) * 1.25
+		p.VehicleID = 42
+		p.StageShakedown = i%100 < 50
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, &Record{Time: base.Add(time.Duration(i) * 16 * time.Millisecond), Data: b})
+		if i%100 == 7 {
+			want = append(want, &Record{Time: base.Add(time.Duration(i) * 16 * time.Millisecond), Data: []byte("sess\x01")})
+		}
+	}
+	for _, rec := range want {
+		if err := w.WriteData(rec.Time, rec.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return want
+}
+
+func check(t *testing.T, buf *bytes.Buffer, want []*Record) {
+	t.Helper()
+	r, err := Open(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, rec := range want {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if !got.Time.Equal(rec.Time) || !bytes.Equal(got.Data, rec.Data) {
+			t.Fatalf("record %d mismatch", i)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF got %v", err)
+	}
+	f, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Stages()) != 2 {
+		t.Fatalf("expected 2 stages got %d", len(f.Stages()))
+	}
+	sr, err := f.SeekDistance(1, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := sr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := rec.Packet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.PacketUID != 320 {
+		t.Fatalf("expected packet 320 got %d", p.PacketUID)
+	}
+}
+
+func TestRaw(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	roundTrip(t, NewWriter(buf), buf)
+}
+
+func TestCompressed(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	roundTrip(t, NewCompressedWriter(buf), buf)
+}
+
+// TestCompressedLayout reads a recording after the channel types changed,
+// the columns must come from the file header.
+func TestCompressedLayout(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	want := write(t, NewCompressedWriter(buf))
+	ch := packet.ChannelDicts["vehicle_speed"]
+	typ := ch.Type
+	ch.Type = "float64"
+	defer func() { ch.Type = typ }()
+	check(t, buf, want)
+}
+
+func TestCorruptLength(t *testing.T) {
+	raw := bytes.NewBuffer(nil)
+	w := NewWriter(raw)
+	if err := w.WriteData(time.Unix(1, 0), []byte("sess\x01")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := raw.Bytes()
+	endian.PutUint32(b[len(Magic)+2:], 0xfffffff0)
+
+	columns, _, err := layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := bytes.NewBufferString(CompressedMagic)
+	binary.Write(head, endian, uint16(compressedVersion))
+	writeColumns(head, columns)
+	block := bytes.NewBuffer([]byte{1})
+	putWords(block, column{typ: "uint64"}.encode([]uint64{1}))
+	putWords(block, column{typ: "uint16"}.encode([]uint64{1 << 40}))
+	sized := append([]byte(nil), head.Bytes()...)
+	length := make([]byte, 4)
+	endian.PutUint32(length, uint32(block.Len()))
+	sized = append(append(sized, length...), block.Bytes()...)
+	huge := append([]byte(nil), head.Bytes()...)
+	huge = append(huge, 0xf0, 0xff, 0xff, 0xff)
+
+	for name, data := range map[string][]byte{"raw": b, "block length": huge, "datagram size": sized} {
+		r, err := Open(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if _, err := r.Next(); err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: got %v, want an invalid length error", name, err)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		compressed bool
+		index      bool
+	}{
+		{"raw", false, true},
+		{"raw without index", false, false},
+		{"compressed", true, true},
+		{"compressed without index", true, false},
+	} {
+		buf := bytes.NewBuffer(nil)
+		var w RecordWriter = NewWriter(buf)
+		if tc.compressed {
+			w = NewCompressedWriter(buf)
+		}
+		for i := 0; i < BlockSize+10; i++ {
+			p := packet.New()
+			p.PacketUID = uint64(i)
+			p.GameTotalTime = float32(i) / 60
+			p.StageCurrentTime = float32(i%300) / 60
+			p.StageCurrentDistance = float64(i) * 1.25
+			if err := w.Write(time.Unix(int64(i), 0), p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var err error
+		if tc.index {
+			err = w.Close()
+		} else {
+			err = w.Flush()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		first := func(r RecordReader, err error) uint64 {
+			t.Helper()
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			rec, err := r.Next()
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			p, err := rec.Packet()
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			return p.PacketUID
+		}
+		for _, c := range []struct {
+			what string
+			got  uint64
+			want uint64
+		}{
+			{"game time 5", first(f.SeekGameTime(5)), 300},
+			{"game time 1.01", first(f.SeekGameTime(1.01)), 61},
+			{"stage 0 time 0", first(f.SeekStageTime(0, 0)), 0},
+			{"stage 1 time 2", first(f.SeekStageTime(1, 2)), 420},
+			{"stage 1 distance 400", first(f.SeekDistance(1, 400)), 320},
+		} {
+			if c.got != c.want {
+				t.Errorf("%s: %s packet %d, want %d", tc.name, c.what, c.got, c.want)
+			}
+		}
+		for stage, n := range []int{300, BlockSize + 10 - 300} {
+			packets, err := f.StagePackets(stage)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if len(packets) != n || packets[0].PacketUID != uint64(300*stage) {
+				t.Errorf("%s: stage %d has %d packets from %d, want %d from %d", tc.name, stage, len(packets), packets[0].PacketUID, n, 300*stage)
+			}
+		}
+		if _, err := f.SeekStageTime(0, 10); err == nil {
+			t.Errorf("%s: seek beyond the stage end succeeded", tc.name)
+		}
+		if _, err := f.SeekDistance(2, 0); err == nil {
+			t.Errorf("%s: seek in a missing stage succeeded", tc.name)
+		}
+	}
+}
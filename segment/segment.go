@@ -0,0 +1,325 @@
+// Package segment splits a route into straights and corners.
+package segment
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+type Kind int
+
+const (
+	Straight Kind = iota
+	Corner
+)
+
+func (k Kind) String() string {
+	if k == Corner {
+		return "corner"
+	}
+	return "straight"
+}
+
+type Direction int
+
+const (
+	None Direction = iota
+	Left
+	Right
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Left:
+		return "left"
+	case Right:
+		return "right"
+	}
+	return ""
+}
+
+// Segment is a straight or a corner. Severity follows pace notes,
+// 1 is the tightest corner and 6 the fastest, 0 for straights.
+type Segment struct {
+	Kind      Kind      `json:"kind"`
+	Number    int       `json:"number"` // 1-based corner number, 0 for straights
+	Direction Direction `json:"direction"`
+	Severity  int       `json:"severity"`
+	Start     float64   `json:"start"`
+	End       float64   `json:"end"`
+	Apex      float64   `json:"apex"`
+	MinRadius float64   `json:"min_radius"`
+	// Angle is the total heading change in degrees.
+	Angle float64 `json:"angle"`
+}
+
+func (s Segment) String() string {
+	if s.Kind == Straight {
+		return fmt.Sprintf("straight %.0f-%.0fm", s.Start, s.End)
+	}
+	return fmt.Sprintf("corner %d %s %d %.0f-%.0fm", s.Number, s.Direction, s.Severity, s.Start, s.End)
+}
+
+// severities are the upper radius limits in metres of pace note severities 1 to 5.
+var severities = []float64{20, 35, 55, 80, 120}
+
+func severity(radius float64) int {
+	for i, r := range severities {
+		if radius < r {
+			return i + 1
+		}
+	}
+	return len(severities) + 1
+}
+
+type Options struct {
+	// Step is the resampling distance in metres. Default 2.
+	Step float64
+	// Window is the distance in metres over which the path tangent is taken. Default 10.
+	Window float64
+	// MinCurvature in 1/m separates corners from straights. Default 1/200.
+	MinCurvature float64
+	// MinLength drops shorter corners and merges shorter straights. Default 10.
+	MinLength float64
+}
+
+func (o *Options) defaults() {
+	if o.Step <= 0 {
+		o.Step = 2
+	}
+	if o.Window <= 0 {
+		o.Window = 10
+	}
+	if o.MinCurvature <= 0 {
+		o.MinCurvature = 1.0 / 200
+	}
+	if o.MinLength <= 0 {
+		o.MinLength = 10
+	}
+}
+
+type vec [3]float64
+
+func (a vec) sub(b vec) vec       { return vec{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func (a vec) add(b vec) vec       { return vec{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func (a vec) scale(k float64) vec { return vec{a[0] * k, a[1] * k, a[2] * k} }
+func (a vec) dot(b vec) float64   { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func (a vec) norm() vec {
+	l := math.Sqrt(a.dot(a))
+	if l == 0 {
+		return a
+	}
+	return a.scale(1 / l)
+}
+
+type sample struct {
+	d       float64
+	pos     vec
+	forward vec
+	left    vec
+}
+
+// resample returns the run at every step metres of stage distance.
+func resample(packets []*packet.Packet, step float64) []sample {
+	raw := []sample{}
+	for _, p := range packets {
+		if n := len(raw); n > 0 && p.StageCurrentDistance <= raw[n-1].d {
+			continue
+		}
+		raw = append(raw, sample{
+			d:       p.StageCurrentDistance,
+			pos:     vec{float64(p.VehiclePositionX), float64(p.VehiclePositionY), float64(p.VehiclePositionZ)},
+			forward: vec{float64(p.VehicleForwardDirectionX), float64(p.VehicleForwardDirectionY), float64(p.VehicleForwardDirectionZ)},
+			left:    vec{float64(p.VehicleLeftDirectionX), float64(p.VehicleLeftDirectionY), float64(p.VehicleLeftDirectionZ)},
+		})
+	}
+	if len(raw) < 2 {
+		return nil
+	}
+	res := []sample{}
+	j := 0
+	for d := math.Ceil(raw[0].d/step) * step; d <= raw[len(raw)-1].d; d += step {
+		for j+2 < len(raw) && raw[j+1].d < d {
+			j++
+		}
+		a, b := raw[j], raw[j+1]
+		f := (d - a.d) / (b.d - a.d)
+		res = append(res, sample{
+			d:       d,
+			pos:     a.pos.add(b.pos.sub(a.pos).scale(f)),
+			forward: a.forward.add(b.forward.sub(a.forward).scale(f)).norm(),
+			left:    a.left.add(b.left.sub(a.left).scale(f)).norm(),
+		})
+	}
+	return res
+}
+
+// curvature returns the signed curvature in 1/m, positive to the left.
+// The tangent is the direction of travel over the window, so slides do not
+// read as corners, and the heading stands in where the car barely moved.
+func curvature(samples []sample, step, window float64) []float64 {
+	w := max(1, int(window/step/2))
+	tangent := make([]vec, len(samples))
+	for i := range samples {
+		lo, hi := max(0, i-w), min(len(samples)-1, i+w)
+		t := samples[hi].pos.sub(samples[lo].pos)
+		if t.dot(t) < 1e-6 {
+			t = samples[i].forward
+		}
+		tangent[i] = t.norm()
+	}
+	k := make([]float64, len(samples))
+	for i := range samples {
+		lo, hi := max(0, i-w), min(len(samples)-1, i+w)
+		if hi == lo {
+			continue
+		}
+		dt := tangent[hi].sub(tangent[lo])
+		k[i] = dt.dot(samples[i].left) / (float64(hi-lo) * step)
+	}
+	return k
+}
+
+// Segmentation is a route split into segments ordered by distance.
+type Segmentation struct {
+	RouteID  uint16    `json:"route_id"`
+	Route    string    `json:"route"`
+	Segments []Segment `json:"segments"`
+}
+
+// Detect segments the route driven in packets, one run of a stage.
+func Detect(packets []*packet.Packet, opts Options) (*Segmentation, error) {
+	opts.defaults()
+	samples := resample(packets, opts.Step)
+	if len(samples) < 3 {
+		return nil, fmt.Errorf("not enough distance covered")
+	}
+	k := curvature(samples, opts.Step, opts.Window)
+	s := &Segmentation{RouteID: packets[0].RouteID, Route: packets[0].Route()}
+	// raw runs of the same kind and direction.
+	dir := func(k float64) Direction {
+		switch {
+		case k >= opts.MinCurvature:
+			return Left
+		case k <= -opts.MinCurvature:
+			return Right
+		}
+		return None
+	}
+	segs := []Segment{}
+	for i := range samples {
+		d := dir(k[i])
+		if n := len(segs); n > 0 && segs[n-1].Direction == d {
+			segs[n-1].End = samples[i].d + opts.Step/2
+			continue
+		}
+		kind := Corner
+		if d == None {
+			kind = Straight
+		}
+		segs = append(segs, Segment{Kind: kind, Direction: d, Start: samples[i].d - opts.Step/2, End: samples[i].d + opts.Step/2})
+	}
+	// drop short corners and straights by merging them into the previous segment.
+	merged := []Segment{}
+	for _, seg := range segs {
+		n := len(merged)
+		if n > 0 && seg.End-seg.Start < opts.MinLength {
+			merged[n-1].End = seg.End
+			continue
+		}
+		if n > 0 && merged[n-1].Direction == seg.Direction {
+			merged[n-1].End = seg.End
+			continue
+		}
+		merged = append(merged, seg)
+	}
+	number := 0
+	for _, seg := range merged {
+		if seg.Kind == Corner {
+			number++
+			seg.Number = number
+			maxK, angle := 0.0, 0.0
+			for i, smp := range samples {
+				if smp.d < seg.Start || smp.d >= seg.End {
+					continue
+				}
+				angle += k[i] * opts.Step
+				if math.Abs(k[i]) > maxK {
+					maxK, seg.Apex = math.Abs(k[i]), smp.d
+				}
+			}
+			seg.MinRadius = 1 / maxK
+			seg.Severity = severity(seg.MinRadius)
+			seg.Angle = math.Abs(angle) * 180 / math.Pi
+		}
+		s.Segments = append(s.Segments, seg)
+	}
+	return s, nil
+}
+
+// Find returns the index of the segment containing distance d, -1 if outside.
+func (s *Segmentation) Find(d float64) int {
+	i := sort.Search(len(s.Segments), func(i int) bool { return s.Segments[i].End > d })
+	if i == len(s.Segments) || d < s.Segments[i].Start {
+		return -1
+	}
+	return i
+}
+
+// Assign returns the segment index of every packet, -1 if outside the segments.
+func (s *Segmentation) Assign(packets []*packet.Packet) []int {
+	res := make([]int, len(packets))
+	for i, p := range packets {
+		res[i] = s.Find(p.StageCurrentDistance)
+	}
+	return res
+}
+
+// Stats are the per segment statistics of a run.
+type Stats struct {
+	Segment
+	Packets    int     `json:"packets"`
+	Time       float32 `json:"time"`
+	EntrySpeed float32 `json:"entry_speed"`
+	ExitSpeed  float32 `json:"exit_speed"`
+	MinSpeed   float32 `json:"min_speed"`
+	MaxSpeed   float32 `json:"max_speed"`
+	AvgSpeed   float32 `json:"avg_speed"`
+}
+
+// Stats computes the statistics of a run for every segment.
+func (s *Segmentation) Stats(packets []*packet.Packet) []Stats {
+	res := make([]Stats, len(s.Segments))
+	first := make([]float32, len(s.Segments))
+	for i, seg := range s.Segments {
+		res[i].Segment = seg
+		res[i].MinSpeed = float32(math.Inf(1))
+	}
+	for i, idx := range s.Assign(packets) {
+		if idx < 0 {
+			continue
+		}
+		p, st := packets[i], &res[idx]
+		if st.Packets == 0 {
+			first[idx] = p.StageCurrentTime
+			st.EntrySpeed = p.VehicleSpeed
+		}
+		st.Packets++
+		st.Time = p.StageCurrentTime - first[idx]
+		st.ExitSpeed = p.VehicleSpeed
+		st.MinSpeed = min(st.MinSpeed, p.VehicleSpeed)
+		st.MaxSpeed = max(st.MaxSpeed, p.VehicleSpeed)
+		st.AvgSpeed += p.VehicleSpeed
+	}
+	for i := range res {
+		if res[i].Packets == 0 {
+			res[i].MinSpeed = 0
+			continue
+		}
+		res[i].AvgSpeed /= float32(res[i].Packets)
+	}
+	return res
+}
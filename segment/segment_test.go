@@ -0,0 +1,153 @@
+package segment
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// leg is a piece of road, straight when the radius is 0, turning left
+// for a positive angle in degrees and right for a negative one.
+type leg struct {
+	length, radius, angle float64
+}
+
+// drive returns packets every half metre along the legs, at 20 m/s
+// slowing to 10 m/s in corners.
+func drive(legs ...leg) []*packet.Packet {
+	packets := []*packet.Packet{}
+	x, z, h, d := 0.0, 0.0, 0.0, 0.0
+	add := func(speed float32) {
+		p := packet.New()
+		p.RouteID = 7
+		p.StageCurrentDistance = d
+		p.StageCurrentTime = float32(len(packets)) / 40
+		p.VehiclePositionX, p.VehiclePositionZ = float32(x), float32(z)
+		p.VehicleForwardDirectionX, p.VehicleForwardDirectionZ = float32(math.Sin(h)), float32(math.Cos(h))
+		p.VehicleLeftDirectionX, p.VehicleLeftDirectionZ = float32(math.Cos(h)), float32(-math.Sin(h))
+		p.VehicleSpeed = speed
+		packets = append(packets, p)
+	}
+	add(20)
+	for _, l := range legs {
+		speed := float32(20)
+		length := l.length
+		if l.radius > 0 {
+			speed = 10
+			length = l.radius * math.Abs(l.angle) * math.Pi / 180
+		}
+		for s := 0.5; s <= length; s += 0.5 {
+			if l.radius > 0 {
+				h += math.Copysign(0.5/l.radius, l.angle)
+			}
+			x += 0.5 * math.Sin(h)
+			z += 0.5 * math.Cos(h)
+			d += 0.5
+			add(speed)
+		}
+	}
+	return packets
+}
+
+func TestDetect(t *testing.T) {
+	packets := drive(leg{length: 100}, leg{radius: 30, angle: 90}, leg{length: 100}, leg{radius: 100, angle: -60}, leg{length: 100})
+	s, err := Detect(packets, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.RouteID != 7 || len(s.Segments) != 5 {
+		t.Fatalf("route %d, segments %v", s.RouteID, s.Segments)
+	}
+	corners := []struct {
+		seg                Segment
+		direction          Direction
+		severity           int
+		start, end, radius float64
+		angle              float64
+	}{
+		{s.Segments[1], Left, 2, 100, 100 + 30*math.Pi/2, 30, 90},
+		{s.Segments[3], Right, 5, 200 + 30*math.Pi/2, 200 + 30*math.Pi/2 + 100*math.Pi/3, 100, 60},
+	}
+	for i, c := range corners {
+		seg := c.seg
+		if seg.Kind != Corner || seg.Number != i+1 || seg.Direction != c.direction || seg.Severity != c.severity {
+			t.Errorf("corner %d: %v", i+1, seg)
+		}
+		// the tangent is taken over the window, so the ends blur by half of it
+		if math.Abs(seg.Start-c.start) > 6 || math.Abs(seg.End-c.end) > 6 {
+			t.Errorf("corner %d from %.1f to %.1f, want %.1f to %.1f", i+1, seg.Start, seg.End, c.start, c.end)
+		}
+		if math.Abs(seg.MinRadius-c.radius)/c.radius > 0.05 || math.Abs(seg.Angle-c.angle) > 3 {
+			t.Errorf("corner %d radius %.1f angle %.1f, want %v and %v", i+1, seg.MinRadius, seg.Angle, c.radius, c.angle)
+		}
+		if seg.Apex < seg.Start || seg.Apex >= seg.End {
+			t.Errorf("corner %d apex %.1f outside %.1f-%.1f", i+1, seg.Apex, seg.Start, seg.End)
+		}
+	}
+	for i := 0; i < len(s.Segments); i += 2 {
+		if seg := s.Segments[i]; seg.Kind != Straight || seg.Number != 0 || seg.Direction != None {
+			t.Errorf("segment %d: %v", i, seg)
+		}
+	}
+	for i := 1; i < len(s.Segments); i++ {
+		if s.Segments[i].Start != s.Segments[i-1].End {
+			t.Errorf("gap between %v and %v", s.Segments[i-1], s.Segments[i])
+		}
+	}
+	if _, err := Detect(packets[:4], Options{}); err == nil {
+		t.Error("detected segments of 1.5 m")
+	}
+}
+
+func TestMinLength(t *testing.T) {
+	// a short kink between two straights is not a corner
+	s, err := Detect(drive(leg{length: 100}, leg{radius: 30, angle: 10}, leg{length: 100}), Options{MinLength: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Segments) != 1 || s.Segments[0].Kind != Straight {
+		t.Errorf("segments %v, want one straight", s.Segments)
+	}
+}
+
+func TestStats(t *testing.T) {
+	packets := drive(leg{length: 100}, leg{radius: 30, angle: 90}, leg{length: 100})
+	s, err := Detect(packets, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last := s.Segments[0], s.Segments[len(s.Segments)-1]
+	for _, tc := range []struct {
+		d    float64
+		want int
+	}{{first.Start - 1, -1}, {first.Start, 0}, {s.Segments[1].Start, 1}, {last.End - 0.1, len(s.Segments) - 1}, {last.End, -1}} {
+		if got := s.Find(tc.d); got != tc.want {
+			t.Errorf("find %.1f: %d, want %d", tc.d, got, tc.want)
+		}
+	}
+	stats := s.Stats(packets)
+	if len(stats) != len(s.Segments) {
+		t.Fatalf("%d stats for %d segments", len(stats), len(s.Segments))
+	}
+	corner := stats[1]
+	if corner.MinSpeed != 10 || corner.MaxSpeed != 20 || corner.Packets == 0 {
+		t.Errorf("corner stats %+v", corner)
+	}
+	// 40 packets a second at half a metre apart
+	if want := float32(corner.Packets-1) / 40; math.Abs(float64(corner.Time-want)) > 1e-4 {
+		t.Errorf("corner time %v, want %v", corner.Time, want)
+	}
+	if straight := stats[0]; straight.EntrySpeed != 20 || straight.AvgSpeed != 20 {
+		t.Errorf("straight stats %+v", straight)
+	}
+	n := 0
+	for _, idx := range s.Assign(packets) {
+		if idx == 1 {
+			n++
+		}
+	}
+	if n != corner.Packets {
+		t.Errorf("%d packets assigned to the corner, want %d", n, corner.Packets)
+	}
+}
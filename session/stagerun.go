@@ -0,0 +1,174 @@
+package session
+
+import (
+	"encoding/json"
+
+	"github.com/nobonobo/easportswrc/packet"
+	"github.com/nobonobo/easportswrc/tyres"
+)
+
+// Wheels holds one value per wheel.
+type Wheels = packet.Wheels
+
+// StageRun summarises one attempt at a stage.
+type StageRun struct {
+	RouteID               uint16  `json:"route_id"`
+	Route                 string  `json:"route"`
+	LocationID            uint16  `json:"location_id"`
+	Location              string  `json:"location"`
+	VehicleID             uint16  `json:"vehicle_id"`
+	Vehicle               string  `json:"vehicle"`
+	VehicleClassID        uint16  `json:"vehicle_class_id"`
+	VehicleClass          string  `json:"vehicle_class"`
+	VehicleManufacturerID uint16  `json:"vehicle_manufacturer_id"`
+	VehicleManufacturer   string  `json:"vehicle_manufacturer"`
+	GameMode              uint8   `json:"game_mode"`
+	GameModeName          string  `json:"game_mode_name"`
+	Shakedown             bool    `json:"shakedown"`
+	StageLength           float64 `json:"stage_length"`
+	// Finished is false for runs that were retired, restarted or abandoned.
+	Finished         bool      `json:"finished"`
+	ResultStatus     uint8     `json:"result_status"`
+	ResultStatusName string    `json:"result_status_name"`
+	ResultTime       float32   `json:"result_time"`
+	Penalty          float32   `json:"penalty"`
+	Splits           []float32 `json:"splits"`
+	// StageTime is the last stage clock, the result time is only set at the finish.
+	StageTime           float32 `json:"stage_time"`
+	TopSpeed            float32 `json:"top_speed"`
+	Distance            float64 `json:"distance"`
+	MaxBrakeTemperature Wheels  `json:"max_brake_temperature"`
+	// TyreEvents are the tyre state changes during the run.
+	TyreEvents []tyres.Event `json:"tyre_events"`
+}
+
+func newStageRun(p *packet.Packet) *StageRun {
+	return &StageRun{
+		RouteID:               p.RouteID,
+		Route:                 p.Route(),
+		LocationID:            p.LocationID,
+		Location:              p.Location(),
+		VehicleID:             p.VehicleID,
+		Vehicle:               p.Vehicle(),
+		VehicleClassID:        p.VehicleClassID,
+		VehicleClass:          p.VehicleClass(),
+		VehicleManufacturerID: p.VehicleManufacturerID,
+		VehicleManufacturer:   p.VehicleManufacturer(),
+		GameMode:              p.GameMode,
+		GameModeName:          p.GameModeString(),
+		Shakedown:             p.StageShakedown,
+		StageLength:           p.StageLength,
+		Splits:                []float32{},
+		TyreEvents:            []tyres.Event{},
+	}
+}
+
+func (r *StageRun) update(p *packet.Packet) {
+	r.StageTime = p.StageCurrentTime
+	r.TopSpeed = max(r.TopSpeed, p.VehicleSpeed)
+	r.Distance = max(r.Distance, p.StageCurrentDistance)
+	for _, pos := range packet.Positions {
+		r.MaxBrakeTemperature.Set(pos, max(r.MaxBrakeTemperature.Get(pos), p.BrakeTemperature(pos)))
+	}
+}
+
+func (r *StageRun) result(p *packet.Packet) {
+	r.ResultStatus = p.StageResultStatus
+	r.ResultStatusName = p.StageResultStatusString()
+	r.ResultTime = p.StageResultTime
+	r.Penalty = p.StageResultTimePenalty
+}
+
+// Faster reports whether r finished faster than o or o did not finish.
+// Runs are ranked by the driven time without penalties, like the splits.
+func (r *StageRun) Faster(o *StageRun) bool {
+	if !r.Finished {
+		return false
+	}
+	return o == nil || !o.Finished || r.ResultTime < o.ResultTime
+}
+
+func (r *StageRun) String() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+// Builder collects StageRuns from a packet stream.
+type Builder struct {
+	Tracker *Tracker
+
+	run   *StageRun
+	tyres *tyres.Detector
+}
+
+func NewBuilder() *Builder {
+	return &Builder{Tracker: NewTracker(), tyres: tyres.NewDetector()}
+}
+
+// Update consumes a packet and returns the events and the run it completed, if any.
+func (b *Builder) Update(p *packet.Packet) ([]Event, *StageRun) {
+	events := b.Tracker.Update(p)
+	return events, b.handle(p, events)
+}
+
+// Datagram is Update for raw datagrams including the dedicated session datagrams.
+func (b *Builder) Datagram(d []byte) ([]Event, *StageRun, error) {
+	events, err := b.Tracker.Datagram(d)
+	if err != nil {
+		return nil, nil, err
+	}
+	return events, b.handle(b.Tracker.last, events), nil
+}
+
+func (b *Builder) handle(p *packet.Packet, events []Event) *StageRun {
+	var done *StageRun
+	for _, ev := range events {
+		switch ev.Type {
+		case StageStarted:
+			b.run = newStageRun(ev.Packet)
+			b.tyres.Reset()
+		case SplitPassed:
+			if b.run != nil {
+				b.run.Splits = append(b.run.Splits, ev.StagePreviousSplitTime)
+			}
+		case StageFinished, StageRetired:
+			if b.run != nil {
+				b.run.update(ev.Packet)
+				b.run.result(ev.Packet)
+				b.run.Finished = ev.Type == StageFinished
+				done, b.run = b.run, nil
+			}
+		case Restarted, ReturnedToMenu:
+			if b.run != nil {
+				done, b.run = b.run, nil
+			}
+		}
+	}
+	if b.run != nil && p != nil {
+		b.run.update(p)
+		b.run.TyreEvents = append(b.run.TyreEvents, b.tyres.Update(p)...)
+	}
+	return done
+}
+
+// Flush returns the run in progress, for example at the end of a recording.
+func (b *Builder) Flush() *StageRun {
+	run := b.run
+	b.run = nil
+	return run
+}
+
+// Build returns the runs contained in packets.
+func Build(packets []*packet.Packet) []*StageRun {
+	b := NewBuilder()
+	runs := []*StageRun{}
+	for _, p := range packets {
+		if _, run := b.Update(p); run != nil {
+			runs = append(runs, run)
+		}
+	}
+	if run := b.Flush(); run != nil {
+		runs = append(runs, run)
+	}
+	return runs
+}
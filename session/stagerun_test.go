@@ -0,0 +1,81 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// runs returns the packets of a run restarted after 100 frames, a finished
+// run with a split, a hot front left brake and a puncture, and a run on
+// another route abandoned at the end of the stream.
+func runs() []*packet.Packet {
+	packets := []*packet.Packet{}
+	stageTime := float32(0)
+	for i := 0; i < 400; i++ {
+		p := packet.New()
+		p.Packet4CC = [4]byte([]byte(FourCCUpdate))
+		p.RouteID, p.VehicleID = 7, 3
+		p.GameTotalTime = float32(i) / 60
+		if i == 100 || i == 300 {
+			stageTime = 0
+		} else {
+			stageTime += 1.0 / 60
+		}
+		p.StageCurrentTime = stageTime
+		p.StageCurrentDistance = float64(stageTime) * 20
+		p.VehicleSpeed = float32(i % 150)
+		p.VehicleBrakeTemperatureFl = 300
+		switch {
+		case i >= 150 && i < 300:
+			p.StagePreviousSplitTime = 50.0 / 60
+		case i >= 300:
+			p.RouteID = 8
+		}
+		if i == 180 {
+			p.VehicleBrakeTemperatureFl = 700
+		}
+		if i >= 190 && i < 300 {
+			p.VehicleTyreStateBr = 1
+		}
+		if i == 299 {
+			p.StageResultStatus = 1
+			p.StageProgress = 1
+			p.StageResultTime = 90
+			p.StageResultTimePenalty = 5
+		}
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func TestBuild(t *testing.T) {
+	got := Build(runs())
+	if len(got) != 3 {
+		t.Fatalf("%d runs, want 3", len(got))
+	}
+	restarted, finished, abandoned := got[0], got[1], got[2]
+	if restarted.Finished || restarted.RouteID != 7 || !near32(restarted.StageTime, 100.0/60) {
+		t.Errorf("restarted run %v", restarted)
+	}
+	if !finished.Finished || finished.ResultTime != 90 || finished.Penalty != 5 || finished.ResultStatus != 1 {
+		t.Errorf("finished run result %v", finished)
+	}
+	if !reflect.DeepEqual(finished.Splits, []float32{50.0 / 60}) {
+		t.Errorf("splits %v, want one at %v", finished.Splits, 50.0/60)
+	}
+	if finished.TopSpeed != 149 || finished.MaxBrakeTemperature.Fl != 700 || finished.MaxBrakeTemperature.Fr != 0 {
+		t.Errorf("top speed %v, brake temperatures %+v", finished.TopSpeed, finished.MaxBrakeTemperature)
+	}
+	if len(finished.TyreEvents) != 1 || finished.TyreEvents[0].Wheel != packet.BackwordRight || finished.TyreEvents[0].To != 1 {
+		t.Errorf("tyre events %v, want the rear right going to 1", finished.TyreEvents)
+	}
+	if abandoned.Finished || abandoned.RouteID != 8 || len(abandoned.TyreEvents) != 0 {
+		t.Errorf("abandoned run %v", abandoned)
+	}
+}
+
+func near32(a, b float32) bool {
+	return a-b < 1e-4 && b-a < 1e-4
+}
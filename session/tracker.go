@@ -0,0 +1,252 @@
+// Package session follows the stage lifecycle from the telemetry stream.
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// 4CC of the dedicated session datagrams.
+const (
+	FourCCStart  = "sess"
+	FourCCUpdate = "sesu"
+	FourCCPause  = "sesp"
+	FourCCResume = "sesr"
+	FourCCEnd    = "sese"
+)
+
+type EventType int
+
+const (
+	StageStarted EventType = iota
+	SplitPassed
+	StageFinished
+	StageRetired
+	Restarted
+	Paused
+	Resumed
+	ReturnedToMenu
+)
+
+func (t EventType) String() string {
+	switch t {
+	case StageStarted:
+		return "StageStarted"
+	case SplitPassed:
+		return "SplitPassed"
+	case StageFinished:
+		return "StageFinished"
+	case StageRetired:
+		return "StageRetired"
+	case Restarted:
+		return "Restarted"
+	case Paused:
+		return "Paused"
+	case Resumed:
+		return "Resumed"
+	case ReturnedToMenu:
+		return "ReturnedToMenu"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a lifecycle change. The embedded packet is the update packet that
+// caused it, or the last one received for dedicated session datagrams, and
+// carries the vehicle, route and game mode.
+type Event struct {
+	Type EventType
+	*packet.Packet
+	// Split is the 1-based split number of SplitPassed.
+	Split int
+}
+
+func (e *Event) String() string {
+	switch e.Type {
+	case SplitPassed:
+		return fmt.Sprintf("%v %d %.3fs %s", e.Type, e.Split, e.StagePreviousSplitTime, e.Route())
+	case StageFinished, StageRetired:
+		return fmt.Sprintf("%v %.3fs +%.3fs %s %s", e.Type, e.StageResultTime, e.StageResultTimePenalty, e.StageResultStatusString(), e.Route())
+	}
+	return fmt.Sprintf("%v %.3fs %s %s %s", e.Type, e.StageCurrentTime, e.Route(), e.Vehicle(), e.GameModeString())
+}
+
+type state int
+
+const (
+	inMenu state = iota
+	waiting
+	running
+	paused
+	ended
+)
+
+// Tracker turns packets and session datagrams into events.
+type Tracker struct {
+	// PauseDelay is the GameTotalTime in seconds the stage clock must stand
+	// still while running before Paused is reported. Default 0.5.
+	PauseDelay float32
+	// RestartTolerance is how far in seconds the stage clock may go back
+	// before it is taken as a restart. Default packet.RestartTolerance.
+	RestartTolerance float32
+
+	state   state
+	last    *packet.Packet
+	split   float32
+	splits  int
+	stallAt float32
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{PauseDelay: 0.5, RestartTolerance: packet.RestartTolerance}
+}
+
+func (t *Tracker) event(typ EventType) Event {
+	p := t.last
+	if p == nil {
+		p = packet.New()
+	}
+	return Event{Type: typ, Packet: p}
+}
+
+// finished tells a finish from a retirement by the result status name or progress.
+func finished(p *packet.Packet) bool {
+	name := strings.ToLower(p.StageResultStatusString())
+	if strings.Contains(name, "not") || strings.Contains(name, "dnf") {
+		return false
+	}
+	return strings.Contains(name, "finish") || p.StageProgress >= 0.999
+}
+
+func (t *Tracker) start(p *packet.Packet) Event {
+	t.state = running
+	t.split = p.StagePreviousSplitTime
+	t.splits = 0
+	t.stallAt = p.GameTotalTime
+	return t.event(StageStarted)
+}
+
+// Update consumes an update packet.
+func (t *Tracker) Update(p *packet.Packet) []Event {
+	events := []Event{}
+	prev := t.last
+	if prev != nil && t.state != inMenu && (p.RouteID != prev.RouteID ||
+		p.VehicleID != prev.VehicleID || p.GameMode != prev.GameMode) {
+		t.state = inMenu
+		events = append(events, t.event(ReturnedToMenu))
+	}
+	// keep a copy, callers may decode every datagram into the same packet
+	cp := *p
+	t.last = &cp
+	if prev == nil {
+		prev = p
+	}
+	restart := p.Restarted(prev.StageCurrentTime, t.RestartTolerance)
+	switch t.state {
+	case inMenu, waiting:
+		t.state = waiting
+		if p.StageResultStatus == 0 && p.StageCurrentTime > 0 {
+			events = append(events, t.start(p))
+		}
+	case paused:
+		if restart {
+			t.state = waiting
+			events = append(events, t.event(Restarted))
+			break
+		}
+		if p.StageCurrentTime == prev.StageCurrentTime {
+			break
+		}
+		t.state = running
+		t.stallAt = p.GameTotalTime
+		events = append(events, t.event(Resumed))
+		events = t.running(p, events)
+	case running:
+		if restart {
+			t.state = waiting
+			events = append(events, t.event(Restarted))
+			break
+		}
+		if p.StageCurrentTime != prev.StageCurrentTime {
+			t.stallAt = p.GameTotalTime
+		} else if p.GameTotalTime-t.stallAt >= t.PauseDelay {
+			t.state = paused
+			events = append(events, t.event(Paused))
+			break
+		}
+		events = t.running(p, events)
+	case ended:
+		if p.StageResultStatus == 0 && (restart || p.StageCurrentTime == 0) {
+			t.state = waiting
+			events = append(events, t.event(Restarted))
+		}
+	}
+	return events
+}
+
+func (t *Tracker) running(p *packet.Packet, events []Event) []Event {
+	if p.StagePreviousSplitTime > 0 && p.StagePreviousSplitTime != t.split {
+		t.split = p.StagePreviousSplitTime
+		t.splits++
+		ev := t.event(SplitPassed)
+		ev.Split = t.splits
+		events = append(events, ev)
+	}
+	if p.StageResultStatus != 0 {
+		t.state = ended
+		if finished(p) {
+			events = append(events, t.event(StageFinished))
+		} else {
+			events = append(events, t.event(StageRetired))
+		}
+	}
+	return events
+}
+
+// Datagram consumes a received datagram, either an update packet
+// or one of the dedicated session datagrams.
+func (t *Tracker) Datagram(b []byte) ([]Event, error) {
+	if len(b) >= 4 {
+		switch string(b[:4]) {
+		case FourCCStart:
+			if t.state == running || t.state == paused {
+				return nil, nil
+			}
+			t.state = waiting
+			return nil, nil
+		case FourCCPause:
+			if t.state != running {
+				return nil, nil
+			}
+			t.state = paused
+			return []Event{t.event(Paused)}, nil
+		case FourCCResume:
+			if t.state != paused {
+				return nil, nil
+			}
+			t.state = running
+			if t.last != nil {
+				t.stallAt = t.last.GameTotalTime
+			}
+			return []Event{t.event(Resumed)}, nil
+		case FourCCEnd:
+			return t.Idle(), nil
+		}
+	}
+	p := packet.New()
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return t.Update(p), nil
+}
+
+// Idle reports ReturnedToMenu unless already in the menu. Call it on a session
+// end or when no datagrams arrived for a while.
+func (t *Tracker) Idle() []Event {
+	if t.state == inMenu {
+		return nil
+	}
+	t.state = inMenu
+	return []Event{t.event(ReturnedToMenu)}
+}
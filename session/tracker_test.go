@@ -0,0 +1,79 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// stage returns the packets of a run restarted after 100 frames, paused
+// for a second and then finished.
+func stage() []*packet.Packet {
+	packets := []*packet.Packet{}
+	stageTime := float32(0)
+	for i := 0; i < 400; i++ {
+		p := packet.New()
+		p.Packet4CC = [4]byte([]byte(FourCCUpdate))
+		p.RouteID, p.VehicleID = 7, 3
+		p.GameTotalTime = float32(i) / 60
+		switch {
+		case i == 100:
+			stageTime = 0
+		case i >= 200 && i < 260:
+			// paused, the stage clock stands still
+		default:
+			stageTime += 1.0 / 60
+		}
+		p.StageCurrentTime = stageTime
+		if i == 399 {
+			p.StageResultStatus = 1
+			p.StageProgress = 1
+		}
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func TestTracker(t *testing.T) {
+	want := []EventType{StageStarted, Restarted, StageStarted, Paused, Resumed, StageFinished}
+	for _, reuse := range []bool{false, true} {
+		tr := NewTracker()
+		got := []EventType{}
+		pkt := packet.New()
+		for _, p := range stage() {
+			if reuse {
+				// decode into one packet like a live receive loop
+				b, err := p.MarshalBinary()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := pkt.UnmarshalBinary(b); err != nil {
+					t.Fatal(err)
+				}
+				p = pkt
+			}
+			for _, ev := range tr.Update(p) {
+				got = append(got, ev.Type)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("reuse %v: events %v, want %v", reuse, got, want)
+		}
+	}
+}
+
+func TestTrackerEventPacket(t *testing.T) {
+	tr := NewTracker()
+	pkt := packet.New()
+	pkt.StageCurrentTime = 1
+	events := tr.Update(pkt)
+	if len(events) != 1 {
+		t.Fatalf("events %v, want StageStarted", events)
+	}
+	pkt.StageCurrentTime = 2
+	tr.Update(pkt)
+	if events[0].StageCurrentTime != 1 {
+		t.Errorf("event packet changed with the caller packet: stage time %v", events[0].StageCurrentTime)
+	}
+}
@@ -0,0 +1,56 @@
+package shiftlights
+
+import (
+	"io"
+	"net"
+)
+
+// Output receives frames.
+type Output interface {
+	WriteFrame(f Frame) error
+	Close() error
+}
+
+// Encode returns the wire form of a frame: 0xff, the number of LEDs and
+// an R, G, B triple per LED. Colour values are limited to 0xfe so the
+// start byte is unambiguous, and frames to MaxLEDs.
+func Encode(f Frame) []byte {
+	f = f[:min(len(f), MaxLEDs)]
+	b := make([]byte, 0, 2+3*len(f))
+	b = append(b, 0xff, byte(len(f)))
+	for _, c := range f {
+		b = append(b, min(c.R, 0xfe), min(c.G, 0xfe), min(c.B, 0xfe))
+	}
+	return b
+}
+
+// WriterOutput writes encoded frames to a stream.
+type WriterOutput struct {
+	w io.Writer
+}
+
+func NewWriterOutput(w io.Writer) *WriterOutput {
+	return &WriterOutput{w: w}
+}
+
+func (o *WriterOutput) WriteFrame(f Frame) error {
+	_, err := o.w.Write(Encode(f))
+	return err
+}
+
+// Close closes the stream when it is an io.Closer.
+func (o *WriterOutput) Close() error {
+	if c, ok := o.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewUDPOutput sends each encoded frame as one datagram to addr.
+func NewUDPOutput(addr string) (*WriterOutput, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterOutput(conn), nil
+}
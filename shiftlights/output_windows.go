@@ -0,0 +1,32 @@
+package shiftlights
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// OpenSerial opens a serial port such as "COM3" at 8N1 and the baud rate.
+func OpenSerial(port string, baud uint32) (*WriterOutput, error) {
+	f, err := os.OpenFile(`\\.\`+port, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	h := windows.Handle(f.Fd())
+	dcb := windows.DCB{}
+	dcb.DCBlength = uint32(unsafe.Sizeof(dcb))
+	if err := windows.GetCommState(h, &dcb); err != nil {
+		f.Close()
+		return nil, err
+	}
+	dcb.BaudRate = baud
+	dcb.ByteSize = 8
+	dcb.Parity = windows.NOPARITY
+	dcb.StopBits = windows.ONESTOPBIT
+	if err := windows.SetCommState(h, &dcb); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return NewWriterOutput(f), nil
+}
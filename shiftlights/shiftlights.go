@@ -0,0 +1,177 @@
+// Package shiftlights renders the shift light channels as LED colour frames.
+package shiftlights
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+type Colour struct {
+	R, G, B uint8
+}
+
+var (
+	Off    = Colour{}
+	Green  = Colour{0, 255, 0}
+	Yellow = Colour{255, 191, 0}
+	Red    = Colour{255, 0, 0}
+	Blue   = Colour{0, 64, 255}
+)
+
+// Frame holds one colour per LED, left to right.
+type Frame []Colour
+
+type Pattern int
+
+const (
+	// Progressive lights the LEDs from left to right.
+	Progressive Pattern = iota
+	// CentreOut lights the LEDs from the centre towards both ends.
+	CentreOut
+	// Flashing keeps the LEDs dark until the limiter.
+	Flashing
+)
+
+func (p Pattern) String() string {
+	switch p {
+	case Progressive:
+		return "progressive"
+	case CentreOut:
+		return "centre-out"
+	case Flashing:
+		return "flashing"
+	}
+	return fmt.Sprintf("Pattern(%d)", int(p))
+}
+
+// MaxLEDs is the largest number of LEDs, the count is sent in one byte
+// below the 0xff start byte.
+const MaxLEDs = 0xfe
+
+type Options struct {
+	// LEDs is the number of LEDs, at most MaxLEDs. Default 15.
+	LEDs int
+	// Pattern is the way the LEDs fill up.
+	Pattern Pattern
+	// Colours are the colours of equal zones from the first LED lit to the
+	// last. Default green, yellow, red.
+	Colours []Colour
+	// Limiter is the fraction from which all LEDs flash in LimiterColour.
+	// Default 0.98, above 1 to disable.
+	Limiter       float32
+	LimiterColour Colour
+	// FlashRate is the flash frequency in Hz. Default 8.
+	FlashRate float32
+	// Start and End are the fallback shift light range as fractions of the
+	// maximum rpm. Default 0.75 and 0.97.
+	Start, End float32
+}
+
+func (o *Options) defaults() {
+	if o.LEDs <= 0 {
+		o.LEDs = 15
+	}
+	o.LEDs = min(o.LEDs, MaxLEDs)
+	if len(o.Colours) == 0 {
+		o.Colours = []Colour{Green, Yellow, Red}
+	}
+	if o.Limiter <= 0 {
+		o.Limiter = 0.98
+	}
+	if o.LimiterColour == Off {
+		o.LimiterColour = Blue
+	}
+	if o.FlashRate <= 0 {
+		o.FlashRate = 8
+	}
+	if o.Start <= 0 {
+		o.Start = 0.75
+	}
+	if o.End <= 0 {
+		o.End = 0.97
+	}
+}
+
+func valid(f float32) bool {
+	return !math.IsNaN(float64(f)) && f >= 0 && f <= 1
+}
+
+// fraction returns the shift light fraction of p. ShiftlightsRpmValid is
+// taken to cover the whole shift light block, so the game fraction is only
+// used when it is set. Otherwise, or when the fraction is out of range, it
+// is computed from the current rpm, between the game start and end rpm when
+// those are valid and between start and end times the maximum rpm otherwise.
+func fraction(p *packet.Packet, start, end float32) float32 {
+	if p.ShiftlightsRpmValid && valid(p.ShiftlightsFraction) {
+		return p.ShiftlightsFraction
+	}
+	lo, hi := start*p.VehicleEngineRpmMax, end*p.VehicleEngineRpmMax
+	if p.ShiftlightsRpmValid && p.ShiftlightsRpmEnd > p.ShiftlightsRpmStart {
+		lo, hi = p.ShiftlightsRpmStart, p.ShiftlightsRpmEnd
+	}
+	if hi <= lo {
+		return 0
+	}
+	return max(0, min(1, (p.VehicleEngineRpmCurrent-lo)/(hi-lo)))
+}
+
+// Fraction returns the shift light fraction of p with the default fallback
+// range. The game fraction is only used with ShiftlightsRpmValid set.
+func Fraction(p *packet.Packet) float32 {
+	o := Options{}
+	o.defaults()
+	return fraction(p, o.Start, o.End)
+}
+
+type Generator struct {
+	opts Options
+}
+
+func New(opts Options) *Generator {
+	opts.defaults()
+	return &Generator{opts: opts}
+}
+
+// LEDs returns the number of LEDs of the frames.
+func (g *Generator) LEDs() int {
+	return g.opts.LEDs
+}
+
+// zone returns the colour of the i-th of n LEDs in fill order.
+func (g *Generator) zone(i, n int) Colour {
+	c := g.opts.Colours
+	return c[min(len(c)-1, i*len(c)/n)]
+}
+
+// Frame renders the frame for p. Flashing follows the game time so replays
+// render the same frames.
+func (g *Generator) Frame(p *packet.Packet) Frame {
+	o := &g.opts
+	f := fraction(p, o.Start, o.End)
+	frame := make(Frame, o.LEDs)
+	if f >= o.Limiter {
+		if int(float64(p.GameTotalTime)*float64(o.FlashRate)*2)%2 == 0 {
+			for i := range frame {
+				frame[i] = o.LimiterColour
+			}
+		}
+		return frame
+	}
+	switch o.Pattern {
+	case Progressive:
+		lit := int(math.Round(float64(f) * float64(o.LEDs)))
+		for i := 0; i < lit; i++ {
+			frame[i] = g.zone(i, o.LEDs)
+		}
+	case CentreOut:
+		half := (o.LEDs + 1) / 2
+		lit := int(math.Round(float64(f) * float64(half)))
+		for i := 0; i < lit; i++ {
+			c := g.zone(i, half)
+			frame[(o.LEDs-1)/2-i], frame[o.LEDs/2+i] = c, c
+		}
+	}
+	return frame
+}
@@ -0,0 +1,109 @@
+package shiftlights
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// at returns a packet with the game shift light fraction f.
+func at(f, gameTime float32) *packet.Packet {
+	p := packet.New()
+	p.ShiftlightsRpmValid = true
+	p.ShiftlightsFraction = f
+	p.GameTotalTime = gameTime
+	return p
+}
+
+// letters writes a frame as one letter per LED, "." for off.
+func letters(f Frame) string {
+	names := map[Colour]byte{Off: '.', Green: 'g', Yellow: 'y', Red: 'r', Blue: 'b'}
+	s := []byte{}
+	for _, c := range f {
+		s = append(s, names[c])
+	}
+	return string(s)
+}
+
+func TestPatterns(t *testing.T) {
+	for _, tc := range []struct {
+		pattern  Pattern
+		leds     int
+		fraction float32
+		gameTime float32
+		want     string
+	}{
+		{Progressive, 5, 0, 0, "....."},
+		{Progressive, 5, 0.5, 0, "ggy.."},
+		{Progressive, 5, 0.97, 0, "ggyyr"},
+		{Progressive, 6, 0.5, 0, "ggy..."},
+		{Progressive, 6, 0.97, 0, "ggyyrr"},
+		{CentreOut, 5, 0.2, 0, "..g.."},
+		{CentreOut, 5, 0.5, 0, ".ygy."},
+		{CentreOut, 5, 0.97, 0, "rygyr"},
+		{CentreOut, 6, 0.2, 0, "..gg.."},
+		{CentreOut, 6, 0.5, 0, ".yggy."},
+		{CentreOut, 6, 0.97, 0, "ryggyr"},
+		{Flashing, 5, 0.97, 0, "....."},
+		{Flashing, 6, 0.5, 0, "......"},
+		// the limiter flashes at 8 Hz on every pattern
+		{Flashing, 5, 0.98, 0, "bbbbb"},
+		{Flashing, 5, 0.98, 1.0 / 16, "....."},
+		{Progressive, 6, 1, 0.125, "bbbbbb"},
+		{CentreOut, 6, 1, 0.1875, "......"},
+	} {
+		g := New(Options{Pattern: tc.pattern, LEDs: tc.leds})
+		if got := letters(g.Frame(at(tc.fraction, tc.gameTime))); got != tc.want {
+			t.Errorf("%v of %d at %v: %s, want %s", tc.pattern, tc.leds, tc.fraction, got, tc.want)
+		}
+	}
+}
+
+func TestFraction(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		set  func(p *packet.Packet)
+		want float32
+	}{
+		{"game fraction", func(p *packet.Packet) { p.ShiftlightsRpmValid, p.ShiftlightsFraction = true, 0.3 }, 0.3},
+		// without the valid flag the fraction is not trusted either
+		{"invalid", func(p *packet.Packet) { p.ShiftlightsFraction = 0.3 }, (7000 - 6000) / (7760 - 6000.0)},
+		{"out of range", func(p *packet.Packet) {
+			p.ShiftlightsRpmValid, p.ShiftlightsFraction = true, float32(math.NaN())
+			p.ShiftlightsRpmStart, p.ShiftlightsRpmEnd = 5000, 9000
+		}, 0.5},
+		{"above the range", func(p *packet.Packet) {
+			p.ShiftlightsRpmValid, p.ShiftlightsFraction = true, 2
+			p.ShiftlightsRpmStart, p.ShiftlightsRpmEnd = 5000, 6000
+		}, 1},
+		{"no maximum", func(p *packet.Packet) { p.VehicleEngineRpmMax = 0 }, 0},
+	} {
+		p := packet.New()
+		p.VehicleEngineRpmCurrent, p.VehicleEngineRpmMax = 7000, 8000
+		tc.set(p)
+		if got := Fraction(p); math.Abs(float64(got-tc.want)) > 1e-6 {
+			t.Errorf("%s: %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	g := New(Options{LEDs: 300})
+	if g.LEDs() != MaxLEDs {
+		t.Errorf("%d LEDs, want %d", g.LEDs(), MaxLEDs)
+	}
+	b := Encode(make(Frame, 300))
+	if len(b) != 2+3*MaxLEDs || b[1] != MaxLEDs || bytes.Count(b, []byte{0xff}) != 1 {
+		t.Errorf("%d bytes with count %d", len(b), b[1])
+	}
+	buf := &bytes.Buffer{}
+	out := NewWriterOutput(buf)
+	if err := out.WriteFrame(Frame{Red, {R: 0xff, G: 0xff, B: 0xff}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xff, 2, 0xfe, 0, 0, 0xfe, 0xfe, 0xfe}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("% x, want % x", buf.Bytes(), want)
+	}
+}
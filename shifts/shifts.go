@@ -0,0 +1,250 @@
+// Package shifts analyses gear changes against the shift light thresholds.
+package shifts
+
+import (
+	"fmt"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+type Options struct {
+	// OverRev is the fraction of VehicleEngineRpmMax counted as over-revving. Default 0.98.
+	OverRev float32
+	// Lugging is the fraction between idle and maximum RPM below which staying
+	// in a gear on throttle is a missed downshift. Default 0.35.
+	Lugging float32
+	// LugDuration is how long in seconds lugging must last to be reported. Default 1.
+	LugDuration float32
+	// FallbackStart and FallbackEnd are the fractions of VehicleEngineRpmMax
+	// used when the shift light RPMs are not valid. Default 0.85 and 0.97.
+	FallbackStart float32
+	FallbackEnd   float32
+}
+
+func (o *Options) defaults() {
+	if o.OverRev <= 0 {
+		o.OverRev = 0.98
+	}
+	if o.Lugging <= 0 {
+		o.Lugging = 0.35
+	}
+	if o.LugDuration <= 0 {
+		o.LugDuration = 1
+	}
+	if o.FallbackStart <= 0 {
+		o.FallbackStart = 0.85
+	}
+	if o.FallbackEnd <= 0 {
+		o.FallbackEnd = 0.97
+	}
+}
+
+// Gear returns the label of the current gear: "R", "N" or the gear number.
+func Gear(p *packet.Packet) string {
+	switch p.VehicleGearIndex {
+	case p.VehicleGearIndexReverse:
+		return "R"
+	case p.VehicleGearIndexNeutral:
+		return "N"
+	}
+	return fmt.Sprint(p.VehicleGearIndex)
+}
+
+func forward(p *packet.Packet) bool {
+	return p.VehicleGearIndex != p.VehicleGearIndexNeutral && p.VehicleGearIndex != p.VehicleGearIndexReverse
+}
+
+// first returns the index of first gear, the lowest index that is neither
+// neutral nor reverse.
+func first(p *packet.Packet) uint8 {
+	g := uint8(0)
+	for g == p.VehicleGearIndexNeutral || g == p.VehicleGearIndexReverse {
+		g++
+	}
+	return g
+}
+
+// Shift is a change between forward gears. Neutral in between, as when
+// the gearbox passes through it, does not break the shift.
+type Shift struct {
+	StageTime float32 `json:"stage_time"`
+	Distance  float64 `json:"distance"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Up        bool    `json:"up"`
+	// RPM is the engine speed in the last packet before the change.
+	RPM      float32 `json:"rpm"`
+	RPMAfter float32 `json:"rpm_after"`
+	// Light is RPM relative to the shift lights, 0 at the start and 1 at the end.
+	Light    float32 `json:"light"`
+	RPMStart float32 `json:"rpm_start"`
+	RPMEnd   float32 `json:"rpm_end"`
+	RPMMax   float32 `json:"rpm_max"`
+	// OverRev is set when RPM or, for downshifts, RPMAfter reached the over-rev limit.
+	OverRev bool `json:"over_rev"`
+	// Early is set for upshifts before the shift lights started.
+	Early bool `json:"early"`
+}
+
+// MissedDownshift is a stretch on throttle with the engine lugging in a gear above first.
+type MissedDownshift struct {
+	StageTime float32 `json:"stage_time"`
+	Distance  float64 `json:"distance"`
+	Gear      string  `json:"gear"`
+	Duration  float32 `json:"duration"`
+	MinRPM    float32 `json:"min_rpm"`
+}
+
+type Summary struct {
+	Shifts           []Shift            `json:"shifts"`
+	MissedDownshifts []MissedDownshift  `json:"missed_downshifts"`
+	TimeInGear       map[string]float64 `json:"time_in_gear"`
+	Upshifts         int                `json:"upshifts"`
+	Downshifts       int                `json:"downshifts"`
+	OverRevs         int                `json:"over_revs"`
+	EarlyShifts      int                `json:"early_shifts"`
+}
+
+// previous holds the last packet in a forward gear.
+type previous struct {
+	gear       uint8
+	label      string
+	rpm        float32
+	rpmMax     float32
+	start, end float32
+}
+
+type Analyzer struct {
+	opts     Options
+	summary  Summary
+	started  bool
+	gameTime float32
+	last     *previous
+	lug      *MissedDownshift
+}
+
+func New(opts Options) *Analyzer {
+	opts.defaults()
+	return &Analyzer{opts: opts, summary: Summary{TimeInGear: map[string]float64{}}}
+}
+
+// lights returns the shift light RPM range, falling back to fractions of the maximum.
+func (a *Analyzer) lights(p *packet.Packet) (float32, float32) {
+	if p.ShiftlightsRpmValid && p.ShiftlightsRpmEnd > p.ShiftlightsRpmStart {
+		return p.ShiftlightsRpmStart, p.ShiftlightsRpmEnd
+	}
+	return p.VehicleEngineRpmMax * a.opts.FallbackStart, p.VehicleEngineRpmMax * a.opts.FallbackEnd
+}
+
+// Update consumes a packet and returns the shift it completed, if any.
+func (a *Analyzer) Update(p *packet.Packet) *Shift {
+	started, gameTime, last := a.started, a.gameTime, a.last
+	a.started, a.gameTime = true, p.GameTotalTime
+	switch {
+	case forward(p):
+		start, end := a.lights(p)
+		a.last = &previous{
+			gear:   p.VehicleGearIndex,
+			label:  Gear(p),
+			rpm:    p.VehicleEngineRpmCurrent,
+			rpmMax: p.VehicleEngineRpmMax,
+			start:  start,
+			end:    end,
+		}
+	case p.VehicleGearIndex == p.VehicleGearIndexReverse:
+		a.last = nil
+	}
+	if !started {
+		return nil
+	}
+	s := &a.summary
+	d := p.Elapsed(gameTime)
+	s.TimeInGear[Gear(p)] += float64(d)
+	a.lugging(p, d)
+	if last == nil || !forward(p) || p.VehicleGearIndex == last.gear {
+		return nil
+	}
+	start, end := last.start, last.end
+	shift := Shift{
+		StageTime: p.StageCurrentTime,
+		Distance:  p.StageCurrentDistance,
+		From:      last.label,
+		To:        Gear(p),
+		Up:        p.VehicleGearIndex > last.gear,
+		RPM:       last.rpm,
+		RPMAfter:  p.VehicleEngineRpmCurrent,
+		RPMStart:  start,
+		RPMEnd:    end,
+		RPMMax:    last.rpmMax,
+	}
+	if end > start {
+		shift.Light = (shift.RPM - start) / (end - start)
+	}
+	limit := shift.RPMMax * a.opts.OverRev
+	if shift.Up {
+		s.Upshifts++
+		shift.OverRev = shift.RPM >= limit
+		shift.Early = shift.RPM < start
+	} else {
+		s.Downshifts++
+		shift.OverRev = shift.RPM >= limit || shift.RPMAfter >= limit
+	}
+	if shift.OverRev {
+		s.OverRevs++
+	}
+	if shift.Early {
+		s.EarlyShifts++
+	}
+	s.Shifts = append(s.Shifts, shift)
+	return &shift
+}
+
+func (a *Analyzer) lugging(p *packet.Packet, d float32) {
+	idle, top := p.VehicleEngineRpmIdle, p.VehicleEngineRpmMax
+	low := idle + (top-idle)*a.opts.Lugging
+	lug := forward(p) && p.VehicleGearIndex > first(p) && p.VehicleThrottle > 0.5 &&
+		top > idle && p.VehicleEngineRpmCurrent < low
+	if a.lug != nil && (!lug || a.lug.Gear != Gear(p)) {
+		if a.lug.Duration >= a.opts.LugDuration {
+			a.summary.MissedDownshifts = append(a.summary.MissedDownshifts, *a.lug)
+		}
+		a.lug = nil
+	}
+	if !lug {
+		return
+	}
+	if a.lug == nil {
+		a.lug = &MissedDownshift{
+			StageTime: p.StageCurrentTime,
+			Distance:  p.StageCurrentDistance,
+			Gear:      Gear(p),
+			MinRPM:    p.VehicleEngineRpmCurrent,
+		}
+	}
+	a.lug.Duration += d
+	a.lug.MinRPM = min(a.lug.MinRPM, p.VehicleEngineRpmCurrent)
+}
+
+// Summary returns the analysis so far.
+func (a *Analyzer) Summary() *Summary {
+	s := a.summary
+	s.Shifts = append([]Shift(nil), s.Shifts...)
+	s.MissedDownshifts = append([]MissedDownshift(nil), s.MissedDownshifts...)
+	s.TimeInGear = map[string]float64{}
+	for k, v := range a.summary.TimeInGear {
+		s.TimeInGear[k] = v
+	}
+	if a.lug != nil && a.lug.Duration >= a.opts.LugDuration {
+		s.MissedDownshifts = append(s.MissedDownshifts, *a.lug)
+	}
+	return &s
+}
+
+// Run analyses a run.
+func Run(packets []*packet.Packet, opts Options) *Summary {
+	a := New(opts)
+	for _, p := range packets {
+		a.Update(p)
+	}
+	return a.Summary()
+}
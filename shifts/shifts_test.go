@@ -0,0 +1,142 @@
+package shifts
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+const (
+	neutral = 0
+	reverse = 10
+)
+
+// drive returns a packet 0.1s apart for every gear and engine speed.
+func drive(gears []uint8, rpms []float32) []*packet.Packet {
+	packets := []*packet.Packet{}
+	for i, g := range gears {
+		p := packet.New()
+		p.GameTotalTime = float32(i) / 10
+		p.StageCurrentTime = p.GameTotalTime
+		p.VehicleGearIndex = g
+		p.VehicleGearIndexNeutral, p.VehicleGearIndexReverse = neutral, reverse
+		p.VehicleEngineRpmCurrent = rpms[i]
+		p.VehicleEngineRpmIdle, p.VehicleEngineRpmMax = 1000, 8000
+		p.ShiftlightsRpmValid = true
+		p.ShiftlightsRpmStart, p.ShiftlightsRpmEnd = 6000, 7500
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func TestShifts(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		gears []uint8
+		rpms  []float32
+		want  []string
+	}{
+		{"up", []uint8{2, 2, 3}, []float32{6000, 7000, 5000}, []string{"2-3"}},
+		{"through neutral", []uint8{3, 3, neutral, neutral, 4, 4}, []float32{6500, 7000, 6000, 5500, 5000, 5200}, []string{"3-4"}},
+		{"back into the same gear", []uint8{3, neutral, 3}, []float32{6000, 5000, 4000}, nil},
+		{"down twice", []uint8{4, 3, 3, neutral, 2}, []float32{4000, 5000, 4500, 3000, 6000}, []string{"4-3", "3-2"}},
+		{"through reverse", []uint8{2, reverse, 1}, []float32{3000, 1000, 2000}, nil},
+	} {
+		s := Run(drive(tc.gears, tc.rpms), Options{})
+		got := []string(nil)
+		for _, sh := range s.Shifts {
+			got = append(got, sh.From+"-"+sh.To)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: shifts %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	s := Run(drive([]uint8{3, 3, neutral, 4}, []float32{6500, 6900, 6000, 5000}), Options{})
+	if len(s.Shifts) != 1 {
+		t.Fatalf("shifts %+v", s.Shifts)
+	}
+	sh := s.Shifts[0]
+	// the engine speed of the last packet in third, not the one in neutral
+	if !sh.Up || sh.RPM != 6900 || sh.RPMAfter != 5000 || math.Abs(float64(sh.Light-0.6)) > 1e-6 || sh.StageTime != 0.3 {
+		t.Errorf("shift %+v", sh)
+	}
+	if s.Upshifts != 1 || s.Downshifts != 0 {
+		t.Errorf("%d up and %d down", s.Upshifts, s.Downshifts)
+	}
+	if math.Abs(s.TimeInGear["N"]-0.1) > 1e-6 || math.Abs(s.TimeInGear["3"]-0.1) > 1e-6 {
+		t.Errorf("time in gear %v", s.TimeInGear)
+	}
+}
+
+func TestShiftQuality(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		gears          []uint8
+		rpms           []float32
+		invalid        bool
+		overRev, early bool
+		start          float32
+	}{
+		{"in the lights", []uint8{2, 3}, []float32{7000, 5000}, false, false, false, 6000},
+		{"early", []uint8{2, 3}, []float32{5000, 4000}, false, false, true, 6000},
+		{"over-rev", []uint8{2, 3}, []float32{7900, 6000}, false, true, false, 6000},
+		{"over-rev after a downshift", []uint8{3, 2}, []float32{6000, 7900}, false, true, false, 6000},
+		{"fallback lights", []uint8{2, 3}, []float32{6500, 5000}, true, false, true, 6800},
+	} {
+		packets := drive(tc.gears, tc.rpms)
+		for _, p := range packets {
+			p.ShiftlightsRpmValid = !tc.invalid
+		}
+		s := Run(packets, Options{})
+		if len(s.Shifts) != 1 {
+			t.Errorf("%s: shifts %+v", tc.name, s.Shifts)
+			continue
+		}
+		sh := s.Shifts[0]
+		if sh.OverRev != tc.overRev || sh.Early != tc.early || sh.RPMStart != tc.start {
+			t.Errorf("%s: %+v", tc.name, sh)
+		}
+	}
+}
+
+func TestMissedDownshift(t *testing.T) {
+	lugging := func(gear uint8, n int) []*packet.Packet {
+		gears, rpms := make([]uint8, n), make([]float32, n)
+		for i := range gears {
+			gears[i], rpms[i] = gear, 2000+float32(i)
+		}
+		packets := drive(gears, rpms)
+		for _, p := range packets {
+			p.VehicleThrottle = 1
+		}
+		return packets
+	}
+	for _, tc := range []struct {
+		name    string
+		packets []*packet.Packet
+		want    int
+	}{
+		{"long enough", lugging(3, 15), 1},
+		{"too short", lugging(3, 10), 0},
+		{"in first gear", lugging(1, 15), 0},
+	} {
+		s := Run(tc.packets, Options{})
+		if len(s.MissedDownshifts) != tc.want {
+			t.Errorf("%s: missed downshifts %+v, want %d", tc.name, s.MissedDownshifts, tc.want)
+		}
+	}
+	// first gear follows the neutral and reverse indices
+	packets := lugging(2, 15)
+	for _, p := range packets {
+		p.VehicleGearIndexReverse, p.VehicleGearIndexNeutral = 0, 1
+	}
+	if s := Run(packets, Options{}); len(s.MissedDownshifts) != 0 {
+		t.Errorf("missed downshifts in first gear at index 2: %+v", s.MissedDownshifts)
+	}
+	s := Run(lugging(3, 15), Options{})
+	if m := s.MissedDownshifts[0]; m.Gear != "3" || m.MinRPM != 2001 || math.Abs(float64(m.Duration-1.4)) > 1e-5 {
+		t.Errorf("missed downshift %+v", m)
+	}
+}
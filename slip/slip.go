@@ -0,0 +1,218 @@
+// Package slip derives per-wheel longitudinal slip and detects wheelspin and lockups.
+//
+// The slip ratio of a wheel is its contact patch forward speed minus the
+// vehicle speed over the vehicle speed: positive under wheelspin, -1 for a
+// locked wheel.
+package slip
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+type Options struct {
+	// MinSpeed is the vehicle speed in m/s below which no slip is computed
+	// and no event is detected. Default 3.
+	MinSpeed float32
+	// Spin is the slip ratio above which a wheel spins. Default 0.15.
+	Spin float32
+	// Lock is the slip ratio below which a wheel locks. Default -0.25.
+	Lock float32
+	// MinDuration is the shortest event reported in seconds. Default 0.1.
+	MinDuration float32
+}
+
+func (o *Options) defaults() {
+	if o.MinSpeed <= 0 {
+		o.MinSpeed = 3
+	}
+	if o.Spin <= 0 {
+		o.Spin = 0.15
+	}
+	if o.Lock >= 0 {
+		o.Lock = -0.25
+	}
+	if o.MinDuration <= 0 {
+		o.MinDuration = 0.1
+	}
+}
+
+func ratio(p *packet.Packet, pos packet.Position, minSpeed float32) float32 {
+	v := p.VehicleSpeed
+	if float32(math.Abs(float64(v))) < minSpeed {
+		return 0
+	}
+	return (p.CpForwardSpeed(pos) - v) / float32(math.Abs(float64(v)))
+}
+
+// Ratios returns the slip ratio of each wheel, zero below minSpeed m/s.
+func Ratios(p *packet.Packet, minSpeed float32) packet.Wheels {
+	w := packet.Wheels{}
+	for _, pos := range packet.Positions {
+		w.Set(pos, ratio(p, pos, minSpeed))
+	}
+	return w
+}
+
+// Sample holds the derived slip channels of one packet.
+type Sample struct {
+	StageTime float32       `json:"stage_time"`
+	Distance  float64       `json:"distance"`
+	Ratio     packet.Wheels `json:"slip_ratio"`
+}
+
+// Channels returns the slip channels of every packet.
+func Channels(packets []*packet.Packet, opts Options) []Sample {
+	opts.defaults()
+	samples := make([]Sample, 0, len(packets))
+	for _, p := range packets {
+		samples = append(samples, Sample{
+			StageTime: p.StageCurrentTime,
+			Distance:  p.StageCurrentDistance,
+			Ratio:     Ratios(p, opts.MinSpeed),
+		})
+	}
+	return samples
+}
+
+type Kind int
+
+const (
+	Wheelspin Kind = iota
+	Lockup
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Wheelspin:
+		return "wheelspin"
+	case Lockup:
+		return "lockup"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Event is a wheelspin or lockup. It is reported when it is over, the
+// times and position are those of its start.
+type Event struct {
+	Kind      Kind            `json:"kind"`
+	Wheel     packet.Position `json:"wheel"`
+	StageTime float32         `json:"stage_time"`
+	Distance  float64         `json:"distance"`
+	X         float32         `json:"x"`
+	Y         float32         `json:"y"`
+	Z         float32         `json:"z"`
+	Duration  float32         `json:"duration"`
+	// Peak is the slip ratio furthest from zero.
+	Peak float32 `json:"peak"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("wheel%s %v at %.0fm %.3fs for %.3fs peak %.2f", e.Wheel, e.Kind, e.Distance, e.StageTime, e.Duration, e.Peak)
+}
+
+type Detector struct {
+	opts   Options
+	ratios packet.Wheels
+	open   [4]*Event
+}
+
+func New(opts Options) *Detector {
+	opts.defaults()
+	return &Detector{opts: opts}
+}
+
+// Ratios returns the slip ratios of the last packet.
+func (d *Detector) Ratios() packet.Wheels {
+	return d.ratios
+}
+
+func (d *Detector) event(pos packet.Position) *Event {
+	for i, p := range packet.Positions {
+		if p == pos {
+			return d.open[i]
+		}
+	}
+	return nil
+}
+
+// Spinning reports whether the wheel is spinning, for a TC style indicator.
+func (d *Detector) Spinning(pos packet.Position) bool {
+	e := d.event(pos)
+	return e != nil && e.Kind == Wheelspin
+}
+
+// Locked reports whether the wheel is locked, for an ABS style indicator.
+func (d *Detector) Locked(pos packet.Position) bool {
+	e := d.event(pos)
+	return e != nil && e.Kind == Lockup
+}
+
+func (d *Detector) close(i int, events []Event) []Event {
+	if e := d.open[i]; e != nil && e.Duration >= d.opts.MinDuration {
+		events = append(events, *e)
+	}
+	d.open[i] = nil
+	return events
+}
+
+// Update consumes a packet and returns the events that ended with it.
+func (d *Detector) Update(p *packet.Packet) []Event {
+	o := &d.opts
+	events := []Event{}
+	d.ratios = Ratios(p, o.MinSpeed)
+	for i, pos := range packet.Positions {
+		r := d.ratios.Get(pos)
+		kind := Kind(-1)
+		switch {
+		case r > o.Spin:
+			kind = Wheelspin
+		case r < o.Lock:
+			kind = Lockup
+		}
+		if e := d.open[i]; e != nil && (e.Kind != kind || p.StageCurrentTime < e.StageTime) {
+			events = d.close(i, events)
+		}
+		if kind < 0 {
+			continue
+		}
+		if d.open[i] == nil {
+			d.open[i] = &Event{
+				Kind:      kind,
+				Wheel:     pos,
+				StageTime: p.StageCurrentTime,
+				Distance:  p.StageCurrentDistance,
+				X:         p.VehiclePositionX,
+				Y:         p.VehiclePositionY,
+				Z:         p.VehiclePositionZ,
+			}
+		}
+		e := d.open[i]
+		e.Duration = p.StageCurrentTime - e.StageTime
+		if math.Abs(float64(r)) > math.Abs(float64(e.Peak)) {
+			e.Peak = r
+		}
+	}
+	return events
+}
+
+// Flush returns the events still in progress.
+func (d *Detector) Flush() []Event {
+	events := []Event{}
+	for i := range d.open {
+		events = d.close(i, events)
+	}
+	return events
+}
+
+// Run detects the events of a run.
+func Run(packets []*packet.Packet, opts Options) []Event {
+	d := New(opts)
+	events := []Event{}
+	for _, p := range packets {
+		events = append(events, d.Update(p)...)
+	}
+	return append(events, d.Flush()...)
+}
@@ -0,0 +1,93 @@
+package slip
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// frame returns a packet at i tenths of a second at speed with the rear
+// wheels turning at rear and the front wheels at front.
+func frame(i int, speed, front, rear float32) *packet.Packet {
+	p := packet.New()
+	p.StageCurrentTime = float32(i) / 10
+	p.StageCurrentDistance = float64(i)
+	p.VehicleSpeed = speed
+	p.VehicleCpForwardSpeedFl, p.VehicleCpForwardSpeedFr = front, front
+	p.VehicleCpForwardSpeedBl, p.VehicleCpForwardSpeedBr = rear, rear
+	return p
+}
+
+func TestRatios(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		speed, front, rear float32
+		want               packet.Wheels
+	}{
+		{"rolling", 20, 20, 20, packet.Wheels{}},
+		{"rear wheelspin", 20, 20, 30, packet.Wheels{Bl: 0.5, Br: 0.5}},
+		{"front lockup", 20, 0, 20, packet.Wheels{Fl: -1, Fr: -1}},
+		{"reversing", -10, -10, -5, packet.Wheels{Bl: 0.5, Br: 0.5}},
+		{"below the minimum speed", 2, 0, 10, packet.Wheels{}},
+	} {
+		if got := Ratios(frame(0, tc.speed, tc.front, tc.rear), 3); got != tc.want {
+			t.Errorf("%s: %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDetector(t *testing.T) {
+	packets := []*packet.Packet{}
+	for i, wheels := range [][2]float32{
+		{20, 20},
+		{20, 26}, // spin
+		{20, 28},
+		{20, 26},
+		{10, 20}, // lock in front, too short
+		{20, 20},
+		{12, 20}, // lock in front
+		{10, 20},
+		{14, 20},
+		{20, 20},
+		{20, 26}, // spin up to the end
+		{20, 26},
+	} {
+		packets = append(packets, frame(i, 20, wheels[0], wheels[1]))
+	}
+	got := []string{}
+	for _, e := range Run(packets, Options{}) {
+		got = append(got, e.String())
+	}
+	want := []string{
+		"wheel_bl wheelspin at 1m 0.100s for 0.200s peak 0.40",
+		"wheel_br wheelspin at 1m 0.100s for 0.200s peak 0.40",
+		"wheel_fl lockup at 6m 0.600s for 0.200s peak -0.50",
+		"wheel_fr lockup at 6m 0.600s for 0.200s peak -0.50",
+		"wheel_bl wheelspin at 10m 1.000s for 0.100s peak 0.30",
+		"wheel_br wheelspin at 10m 1.000s for 0.100s peak 0.30",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events\n%v, want\n%v", got, want)
+	}
+}
+
+func TestIndicators(t *testing.T) {
+	d := New(Options{})
+	d.Update(frame(3, 20, 10, 30))
+	if !d.Locked(packet.ForwardLeft) || d.Spinning(packet.ForwardLeft) || !d.Spinning(packet.BackwordRight) {
+		t.Error("front not locked or rear not spinning")
+	}
+	if r := d.Ratios(); r.Fl != -0.5 || r.Br != 0.5 {
+		t.Errorf("ratios %+v", r)
+	}
+	// a restart ends the events even when the wheels still slip
+	d.Update(frame(6, 20, 10, 30))
+	if ev := d.Update(frame(1, 20, 10, 30)); len(ev) != 4 {
+		t.Errorf("events %v at the restart", ev)
+	}
+	d.Update(frame(2, 20, 20, 20))
+	if d.Locked(packet.ForwardLeft) || d.Spinning(packet.BackwordRight) {
+		t.Error("indicators still on")
+	}
+}
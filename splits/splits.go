@@ -0,0 +1,161 @@
+// Package splits records split times and compares them with a reference run.
+package splits
+
+import (
+	"github.com/nobonobo/easportswrc/packet"
+	"github.com/nobonobo/easportswrc/session"
+)
+
+// Reference is the run to compare against, such as a personal best or a teammate's run.
+type Reference struct {
+	Name string `json:"name"`
+	// Splits are stage times at each split.
+	Splits []float32 `json:"splits"`
+	// ResultTime is the driven time without penalties, like the splits.
+	ResultTime float32 `json:"result_time"`
+}
+
+// NewReference makes a reference of a finished run.
+func NewReference(name string, run *session.StageRun) *Reference {
+	return &Reference{Name: name, Splits: run.Splits, ResultTime: run.ResultTime}
+}
+
+// Best returns the fastest finished run as a reference, nil if none finished.
+func Best(name string, runs []*session.StageRun) *Reference {
+	var best *session.StageRun
+	for _, run := range runs {
+		if run.Faster(best) {
+			best = run
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return NewReference(name, best)
+}
+
+// Delta is the comparison at a split. The finish is reported as the split after the last one.
+type Delta struct {
+	// Split is the 1-based split number.
+	Split  int     `json:"split"`
+	Finish bool    `json:"finish"`
+	Time   float32 `json:"time"`
+	// Sector is the time since the previous split.
+	Sector float32 `json:"sector"`
+	// Reference, Delta, SectorDelta and PredictedFinish are valid if HasReference.
+	HasReference    bool    `json:"has_reference"`
+	Reference       float32 `json:"reference"`
+	Delta           float32 `json:"delta"`
+	SectorDelta     float32 `json:"sector_delta"`
+	PredictedFinish float32 `json:"predicted_finish"`
+}
+
+// Tracker records every split of each run and compares them live with Reference.
+type Tracker struct {
+	Reference *Reference
+
+	tracker *session.Tracker
+	splits  []float32
+	deltas  []Delta
+	runs    [][]float32
+}
+
+func NewTracker(ref *Reference) *Tracker {
+	return &Tracker{Reference: ref, tracker: session.NewTracker()}
+}
+
+func (t *Tracker) refAt(i int, finish bool) (float32, bool) {
+	if t.Reference == nil {
+		return 0, false
+	}
+	if finish {
+		return t.Reference.ResultTime, t.Reference.ResultTime > 0
+	}
+	if i >= len(t.Reference.Splits) {
+		return 0, false
+	}
+	return t.Reference.Splits[i], true
+}
+
+func (t *Tracker) pass(time float32, finish bool) Delta {
+	i := len(t.splits)
+	prev := float32(0)
+	if i > 0 {
+		prev = t.splits[i-1]
+	}
+	t.splits = append(t.splits, time)
+	d := Delta{Split: i + 1, Finish: finish, Time: time, Sector: time - prev}
+	if ref, ok := t.refAt(i, finish); ok {
+		refPrev := float32(0)
+		if i > 0 {
+			refPrev, _ = t.refAt(i-1, false)
+		}
+		d.HasReference = true
+		d.Reference = ref
+		d.Delta = time - ref
+		d.SectorDelta = d.Sector - (ref - refPrev)
+		d.PredictedFinish = t.Reference.ResultTime + d.Delta
+	}
+	t.deltas = append(t.deltas, d)
+	return d
+}
+
+// Update consumes a packet and returns the delta when a split or the finish was passed.
+func (t *Tracker) Update(p *packet.Packet) *Delta {
+	var res *Delta
+	for _, ev := range t.tracker.Update(p) {
+		switch ev.Type {
+		case session.StageStarted:
+			t.splits, t.deltas = nil, nil
+		case session.SplitPassed:
+			d := t.pass(ev.StagePreviousSplitTime, false)
+			res = &d
+		case session.StageFinished:
+			d := t.pass(ev.StageResultTime, true)
+			res = &d
+			t.runs = append(t.runs, t.splits)
+		}
+	}
+	return res
+}
+
+// Splits returns the split times of the current or last run.
+func (t *Tracker) Splits() []float32 {
+	return t.splits
+}
+
+// Deltas returns the comparisons of the current or last run.
+func (t *Tracker) Deltas() []Delta {
+	return t.deltas
+}
+
+// Runs returns the split times of every finished run, the finish included.
+func (t *Tracker) Runs() [][]float32 {
+	return t.runs
+}
+
+// Predicted returns the predicted finish time for the stage time now.
+// It extrapolates the last split delta, and once now is past the reference
+// time of the next split, the time already lost against it.
+// ok is false without a reference.
+func (t *Tracker) Predicted(now float32) (finish float32, ok bool) {
+	if t.Reference == nil || t.Reference.ResultTime <= 0 {
+		return 0, false
+	}
+	finish = t.Reference.ResultTime
+	if len(t.deltas) > 0 {
+		last := t.deltas[len(t.deltas)-1]
+		if !last.HasReference {
+			return 0, false
+		}
+		if last.Finish {
+			return last.Time, true
+		}
+		finish = last.PredictedFinish
+	}
+	next, ok := t.refAt(len(t.splits), len(t.splits) >= len(t.Reference.Splits))
+	if ok && now > next {
+		finish = max(finish, t.Reference.ResultTime+now-next)
+	}
+	return finish, true
+}
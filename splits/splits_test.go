@@ -0,0 +1,99 @@
+package splits
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+	"github.com/nobonobo/easportswrc/session"
+)
+
+// stage returns a run at 10 packets per second passing splits at 31s
+// and 58s and finishing in 88s.
+func stage() []*packet.Packet {
+	packets := []*packet.Packet{}
+	for i := 1; i <= 880; i++ {
+		p := packet.New()
+		p.StageCurrentTime = float32(i) / 10
+		switch {
+		case i >= 580:
+			p.StagePreviousSplitTime = 58
+		case i >= 310:
+			p.StagePreviousSplitTime = 31
+		}
+		if i == 880 {
+			p.StageResultStatus = 1
+			p.StageProgress = 1
+			p.StageResultTime = 88
+		}
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func TestTracker(t *testing.T) {
+	ref := &Reference{Splits: []float32{30, 60}, ResultTime: 90}
+	tr := NewTracker(ref)
+	predicted := map[int]float32{}
+	for i, p := range stage() {
+		tr.Update(p)
+		if finish, ok := tr.Predicted(p.StageCurrentTime); ok {
+			predicted[i+1] = finish
+		}
+	}
+	want := []Delta{
+		{Split: 1, Time: 31, Sector: 31, HasReference: true, Reference: 30, Delta: 1, SectorDelta: 1, PredictedFinish: 91},
+		{Split: 2, Time: 58, Sector: 27, HasReference: true, Reference: 60, Delta: -2, SectorDelta: -3, PredictedFinish: 88},
+		{Split: 3, Finish: true, Time: 88, Sector: 30, HasReference: true, Reference: 90, Delta: -2, SectorDelta: 0, PredictedFinish: 88},
+	}
+	if got := tr.Deltas(); !reflect.DeepEqual(got, want) {
+		t.Errorf("deltas\n%+v, want\n%+v", got, want)
+	}
+	if got := tr.Runs(); !reflect.DeepEqual(got, [][]float32{{31, 58, 88}}) {
+		t.Errorf("runs %v", got)
+	}
+	for packet, finish := range map[int]float32{
+		200: 90, // on the reference pace
+		305: 90.5,
+		400: 91,
+		700: 88,
+		880: 88,
+	} {
+		if got := predicted[packet]; !near(got, finish) {
+			t.Errorf("predicted at %gs %v, want %v", float32(packet)/10, got, finish)
+		}
+	}
+}
+
+func TestTrackerWithoutReference(t *testing.T) {
+	tr := NewTracker(nil)
+	for _, p := range stage() {
+		if d := tr.Update(p); d != nil && d.HasReference {
+			t.Errorf("delta %+v with a reference", d)
+		}
+		if _, ok := tr.Predicted(p.StageCurrentTime); ok {
+			t.Fatal("predicted without a reference")
+		}
+	}
+	if len(tr.Deltas()) != 3 {
+		t.Errorf("deltas %v, want 3", tr.Deltas())
+	}
+}
+
+func TestBest(t *testing.T) {
+	runs := []*session.StageRun{
+		{Finished: true, ResultTime: 100, Splits: []float32{50}},
+		{Finished: true, ResultTime: 95, Penalty: 10, Splits: []float32{45}},
+		{Finished: false, ResultTime: 0, StageTime: 20},
+	}
+	if ref := Best("me", runs); ref == nil || ref.ResultTime != 95 || ref.Splits[0] != 45 {
+		t.Errorf("best %+v, want the 95s run", ref)
+	}
+	if ref := Best("me", runs[2:]); ref != nil {
+		t.Errorf("best of unfinished runs %+v, want nil", ref)
+	}
+}
+
+func near(a, b float32) bool {
+	return a-b < 1e-3 && b-a < 1e-3
+}
@@ -0,0 +1,264 @@
+// Package store keeps stage run history and personal bests in a local folder.
+//
+// The folder holds runs.jsonl, one Entry per line appended as runs are added,
+// and telemetry/<id>.recz with the compressed telemetry of the current
+// personal bests. The telemetry of a beaten personal best is deleted.
+// Runs are ranked by session.StageRun.Faster, the driven time without penalties.
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nobonobo/easportswrc/packet"
+	"github.com/nobonobo/easportswrc/recording"
+	"github.com/nobonobo/easportswrc/session"
+)
+
+const (
+	runsFile     = "runs.jsonl"
+	telemetryDir = "telemetry"
+)
+
+// Key groups comparable runs.
+type Key struct {
+	RouteID        uint16 `json:"route_id"`
+	VehicleClassID uint16 `json:"vehicle_class_id"`
+	GameMode       uint8  `json:"game_mode"`
+	// VehicleID narrows the key to one vehicle when HasVehicle is set.
+	VehicleID  uint16 `json:"vehicle_id"`
+	HasVehicle bool   `json:"has_vehicle"`
+}
+
+// KeyOf returns the class level key of run.
+func KeyOf(run *session.StageRun) Key {
+	return Key{RouteID: run.RouteID, VehicleClassID: run.VehicleClassID, GameMode: run.GameMode}
+}
+
+func (k Key) match(run *session.StageRun) bool {
+	if run.RouteID != k.RouteID || run.VehicleClassID != k.VehicleClassID || run.GameMode != k.GameMode {
+		return false
+	}
+	return !k.HasVehicle || run.VehicleID == k.VehicleID
+}
+
+type Entry struct {
+	ID      string            `json:"id"`
+	Driver  string            `json:"driver"`
+	AddedAt time.Time         `json:"added_at"`
+	Run     *session.StageRun `json:"run"`
+	// Telemetry is the path of the retained telemetry relative to the store, if any.
+	Telemetry string `json:"telemetry,omitempty"`
+}
+
+// Total returns the result time with penalty.
+func (e *Entry) Total() float32 {
+	return e.Run.ResultTime + e.Run.Penalty
+}
+
+type Store struct {
+	// KeepTelemetry retains the telemetry of runs that are a new personal best
+	// and deletes that of the personal best they beat.
+	KeepTelemetry bool
+
+	mu      sync.Mutex
+	dir     string
+	entries []*Entry
+	seq     int
+}
+
+// Open loads the store in dir, creating the folder if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, telemetryDir), 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir}
+	f, err := os.Open(filepath.Join(dir, runsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := json.NewDecoder(bufio.NewReader(f))
+	for {
+		e := &Entry{}
+		if err := d.Decode(e); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("%s: %w", runsFile, err)
+		}
+		if e.Telemetry != "" {
+			// runs.jsonl is append only, beaten bests still name their deleted telemetry
+			if _, err := os.Stat(filepath.Join(dir, e.Telemetry)); errors.Is(err, os.ErrNotExist) {
+				e.Telemetry = ""
+			}
+		}
+		s.entries = append(s.entries, e)
+	}
+	return s, nil
+}
+
+func (s *Store) append(e *Entry) error {
+	f, err := os.OpenFile(filepath.Join(s.dir, runsFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(e); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *Store) writeTelemetry(e *Entry, packets []*packet.Packet) error {
+	name := filepath.Join(telemetryDir, e.ID+".recz")
+	f, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return err
+	}
+	w := recording.NewCompressedWriter(f)
+	for _, p := range packets {
+		t := e.AddedAt.Add(time.Duration(float64(p.GameTotalTime-packets[0].GameTotalTime) * float64(time.Second)))
+		if err := w.Write(t, p); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	e.Telemetry = name
+	return f.Close()
+}
+
+// Add stores run for driver. packets is the telemetry of the run and may be nil,
+// it is retained when KeepTelemetry is set and the run is a new personal best.
+// When only deleting the telemetry of the beaten best fails, the entry is
+// stored and returned with the error.
+func (s *Store) Add(driver string, run *session.StageRun, packets []*packet.Packet) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.seq++
+	e := &Entry{
+		ID:      fmt.Sprintf("%d-%d", now.UnixNano(), s.seq),
+		Driver:  driver,
+		AddedAt: now,
+		Run:     run,
+	}
+	var beaten *Entry
+	if s.KeepTelemetry && len(packets) > 0 && run.Finished {
+		best := s.personalBest(driver, KeyOf(run))
+		if best == nil || run.Faster(best.Run) {
+			if err := s.writeTelemetry(e, packets); err != nil {
+				return nil, err
+			}
+			beaten = best
+		}
+	}
+	if err := s.append(e); err != nil {
+		return nil, err
+	}
+	s.entries = append(s.entries, e)
+	if beaten != nil && beaten.Telemetry != "" {
+		err := os.Remove(filepath.Join(s.dir, beaten.Telemetry))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return e, err
+		}
+		beaten.Telemetry = ""
+	}
+	return e, nil
+}
+
+func (s *Store) personalBest(driver string, key Key) *Entry {
+	var best *Entry
+	var bestRun *session.StageRun
+	for _, e := range s.entries {
+		if e.Driver == driver && key.match(e.Run) && e.Run.Faster(bestRun) {
+			best, bestRun = e, e.Run
+		}
+	}
+	return best
+}
+
+// PersonalBest returns the fastest finished run of driver for key, nil if none.
+func (s *Store) PersonalBest(driver string, key Key) *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.personalBest(driver, key)
+}
+
+// Leaderboard returns the personal best of every driver for key, fastest first.
+func (s *Store) Leaderboard(key Key) []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	drivers := map[string]bool{}
+	board := []*Entry{}
+	for _, e := range s.entries {
+		if drivers[e.Driver] {
+			continue
+		}
+		drivers[e.Driver] = true
+		if best := s.personalBest(e.Driver, key); best != nil {
+			board = append(board, best)
+		}
+	}
+	sort.SliceStable(board, func(i, j int) bool { return board[i].Run.Faster(board[j].Run) })
+	return board
+}
+
+// History returns every run for key in the order added, of one driver or all when driver is "".
+func (s *Store) History(driver string, key Key) []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := []*Entry{}
+	for _, e := range s.entries {
+		if (driver == "" || e.Driver == driver) && key.match(e.Run) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Telemetry reads the retained telemetry of e.
+func (s *Store) Telemetry(e *Entry) ([]*packet.Packet, error) {
+	if e.Telemetry == "" {
+		return nil, fmt.Errorf("run %s has no telemetry", e.ID)
+	}
+	f, err := os.Open(filepath.Join(s.dir, e.Telemetry))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := recording.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	packets := []*packet.Packet{}
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return packets, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p, err := rec.Packet()
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, p)
+	}
+}
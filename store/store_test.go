@@ -0,0 +1,129 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+	"github.com/nobonobo/easportswrc/session"
+)
+
+func finished(result, penalty float32) *session.StageRun {
+	return &session.StageRun{RouteID: 7, VehicleClassID: 2, VehicleID: 3, Finished: true, ResultTime: result, Penalty: penalty}
+}
+
+func telemetry(n int) []*packet.Packet {
+	packets := []*packet.Packet{}
+	for i := 0; i < n; i++ {
+		p := packet.New()
+		p.GameTotalTime = float32(i) / 60
+		p.PacketUID = uint64(i)
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func exists(t *testing.T, s *Store, e *Entry) bool {
+	t.Helper()
+	if e.Telemetry == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(s.dir, e.Telemetry))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestPersonalBestTelemetry(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.KeepTelemetry = true
+	add := func(driver string, run *session.StageRun, packets []*packet.Packet) *Entry {
+		t.Helper()
+		e, err := s.Add(driver, run, packets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	first := add("me", finished(100, 0), telemetry(10))
+	if !exists(t, s, first) {
+		t.Fatal("telemetry of the first best not kept")
+	}
+	slower := add("me", finished(110, 0), telemetry(10))
+	retired := add("me", &session.StageRun{RouteID: 7, VehicleClassID: 2, ResultTime: 50}, telemetry(10))
+	other := add("you", finished(90, 0), telemetry(10))
+	if exists(t, s, slower) || exists(t, s, retired) || !exists(t, s, first) || !exists(t, s, other) {
+		t.Fatal("telemetry kept for a run that is not a personal best")
+	}
+	// faster driven time, penalties do not count as in the splits
+	best := add("me", finished(95, 30), telemetry(20))
+	if !exists(t, s, best) {
+		t.Fatal("telemetry of the new best not kept")
+	}
+	if first.Telemetry != "" {
+		t.Errorf("beaten best still names its telemetry %s", first.Telemetry)
+	}
+	files, err := os.ReadDir(filepath.Join(dir, telemetryDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("%d telemetry files, want the bests of both drivers", len(files))
+	}
+	packets, err := s.Telemetry(best)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 20 || packets[19].PacketUID != 19 {
+		t.Errorf("read %d packets of the best", len(packets))
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := KeyOf(first.Run)
+	if pb := reopened.PersonalBest("me", key); pb == nil || pb.ID != best.ID || pb.Telemetry == "" {
+		t.Errorf("personal best %+v, want %s", pb, best.ID)
+	}
+	for _, e := range reopened.History("me", key) {
+		if e.ID == first.ID && e.Telemetry != "" {
+			t.Errorf("reopened beaten best names its deleted telemetry %s", e.Telemetry)
+		}
+	}
+	if n := len(reopened.History("", key)); n != 5 {
+		t.Errorf("history of %d runs, want 5", n)
+	}
+	board := reopened.Leaderboard(key)
+	if len(board) != 2 || board[0].ID != other.ID || board[1].ID != best.ID {
+		t.Errorf("leaderboard %v", board)
+	}
+	key.VehicleID, key.HasVehicle = 4, true
+	if pb := reopened.PersonalBest("me", key); pb != nil {
+		t.Errorf("personal best of another vehicle %+v", pb)
+	}
+}
+
+func TestWithoutTelemetry(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := s.Add("me", finished(100, 0), telemetry(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Telemetry != "" {
+		t.Errorf("telemetry %s kept without KeepTelemetry", e.Telemetry)
+	}
+	if _, err := s.Telemetry(e); err == nil {
+		t.Error("reading missing telemetry succeeded")
+	}
+}
@@ -0,0 +1,233 @@
+// Package suspension analyses hub travel and damper speed for setup work.
+//
+// The hub positions are taken as suspension travel and the hub velocities
+// as damper speed, positive in compression unless Options.Inverted is set.
+package suspension
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+type Options struct {
+	// Inverted takes negative positions and velocities as compression.
+	Inverted bool
+	// Knee is the damper speed in m/s that separates low from high speed. Default 0.1.
+	Knee float64
+	// TravelBins is the number of travel histogram bins. Default 20.
+	TravelBins int
+	// VelocityWidth is the width in m/s of the damper speed histogram bins,
+	// spanning ±VelocityRange with the outer bins collecting the rest. Default 0.025 and 0.5.
+	VelocityWidth float64
+	VelocityRange float64
+	// MinTravel and MaxTravel are the travel limits of the car. Bottoming and
+	// topping out are only reported when they are set, the range observed over
+	// a run always reaches its own limits. When both are zero the observed
+	// range spans the travel histogram.
+	MinTravel float64
+	MaxTravel float64
+	// Margin is the fraction of the travel range from a limit counted as
+	// bottoming or topping out. Default 0.02.
+	Margin float64
+}
+
+func (o *Options) defaults() {
+	if o.Knee <= 0 {
+		o.Knee = 0.1
+	}
+	if o.TravelBins <= 0 {
+		o.TravelBins = 20
+	}
+	if o.VelocityWidth <= 0 {
+		o.VelocityWidth = 0.025
+	}
+	if o.VelocityRange <= 0 {
+		o.VelocityRange = 0.5
+	}
+	if o.Margin <= 0 {
+		o.Margin = 0.02
+	}
+}
+
+// Histogram holds the time in seconds spent in bins of Width from Min.
+type Histogram struct {
+	Min    float64   `json:"min"`
+	Width  float64   `json:"width"`
+	Counts []float64 `json:"counts"`
+}
+
+func (h *Histogram) add(v, d float64) {
+	i := int(math.Floor((v - h.Min) / h.Width))
+	i = max(0, min(len(h.Counts)-1, i))
+	h.Counts[i] += d
+}
+
+type EventKind int
+
+const (
+	Bottoming EventKind = iota
+	ToppingOut
+)
+
+func (k EventKind) String() string {
+	if k == ToppingOut {
+		return "topping out"
+	}
+	return "bottoming"
+}
+
+// Event is a stretch with the hub at a travel limit, reported only with
+// Options.MinTravel and MaxTravel.
+type Event struct {
+	Kind      EventKind       `json:"kind"`
+	Wheel     packet.Position `json:"wheel"`
+	StageTime float32         `json:"stage_time"`
+	Distance  float64         `json:"distance"`
+	Duration  float32         `json:"duration"`
+	// Velocity is the damper speed when the limit was reached.
+	Velocity float64 `json:"velocity"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("hub%s %v at %.0fm for %.3fs", e.Wheel, e.Kind, e.Distance, e.Duration)
+}
+
+// Wheel is the analysis of one corner. Times are in seconds.
+type Wheel struct {
+	Position    packet.Position `json:"position"`
+	Travel      Histogram       `json:"travel"`
+	Velocity    Histogram       `json:"velocity"`
+	MinTravel   float64         `json:"min_travel"`
+	MaxTravel   float64         `json:"max_travel"`
+	AvgTravel   float64         `json:"avg_travel"`
+	AvgSpeed    float64         `json:"avg_speed"` // mean absolute damper speed
+	BumpLow     float64         `json:"bump_low"`
+	BumpHigh    float64         `json:"bump_high"`
+	ReboundLow  float64         `json:"rebound_low"`
+	ReboundHigh float64         `json:"rebound_high"`
+	Events      []Event         `json:"events"`
+}
+
+// Balance compares the axles, front minus rear.
+type Balance struct {
+	FrontTravel float64 `json:"front_travel"`
+	RearTravel  float64 `json:"rear_travel"`
+	FrontSpeed  float64 `json:"front_speed"`
+	RearSpeed   float64 `json:"rear_speed"`
+	TravelDiff  float64 `json:"travel_diff"`
+	SpeedDiff   float64 `json:"speed_diff"`
+}
+
+type Analysis struct {
+	Time    float64  `json:"time"`
+	Wheels  [4]Wheel `json:"wheels"`
+	Balance Balance  `json:"balance"`
+}
+
+func hub(p *packet.Packet, pos packet.Position, sign float64) (float64, float64) {
+	return sign * float64(p.HubPosition(pos)), sign * float64(p.HubVelocity(pos))
+}
+
+// Analyze analyses a run.
+func Analyze(packets []*packet.Packet, opts Options) *Analysis {
+	opts.defaults()
+	sign := 1.0
+	if opts.Inverted {
+		sign = -1
+	}
+	limits := opts.MinTravel != 0 || opts.MaxTravel != 0
+	a := &Analysis{}
+	for i, pos := range packet.Positions {
+		w := &a.Wheels[i]
+		w.Position = pos
+		w.MinTravel, w.MaxTravel = math.Inf(1), math.Inf(-1)
+		for _, p := range packets {
+			x, _ := hub(p, pos, sign)
+			w.MinTravel, w.MaxTravel = math.Min(w.MinTravel, x), math.Max(w.MaxTravel, x)
+		}
+		switch {
+		case limits:
+			w.MinTravel, w.MaxTravel = sign*opts.MinTravel, sign*opts.MaxTravel
+			if w.MinTravel > w.MaxTravel {
+				w.MinTravel, w.MaxTravel = w.MaxTravel, w.MinTravel
+			}
+		case len(packets) == 0:
+			w.MinTravel, w.MaxTravel = 0, 0
+		}
+		span := math.Max(w.MaxTravel-w.MinTravel, 1e-6)
+		w.Travel = Histogram{Min: w.MinTravel, Width: span / float64(opts.TravelBins), Counts: make([]float64, opts.TravelBins)}
+		n := int(math.Ceil(2 * opts.VelocityRange / opts.VelocityWidth))
+		w.Velocity = Histogram{Min: -opts.VelocityRange, Width: opts.VelocityWidth, Counts: make([]float64, n)}
+		w.Events = []Event{}
+	}
+	open := [4]*Event{}
+	for j, p := range packets {
+		d := 0.0
+		if j > 0 {
+			d = float64(p.Elapsed(packets[j-1].GameTotalTime))
+		}
+		a.Time += d
+		for i, pos := range packet.Positions {
+			w := &a.Wheels[i]
+			x, v := hub(p, pos, sign)
+			w.Travel.add(x, d)
+			w.Velocity.add(v, d)
+			w.AvgTravel += x * d
+			w.AvgSpeed += math.Abs(v) * d
+			switch {
+			case v >= opts.Knee:
+				w.BumpHigh += d
+			case v >= 0:
+				w.BumpLow += d
+			case v > -opts.Knee:
+				w.ReboundLow += d
+			default:
+				w.ReboundHigh += d
+			}
+			if !limits {
+				continue
+			}
+			margin := (w.MaxTravel - w.MinTravel) * opts.Margin
+			kind, limit := EventKind(-1), false
+			switch {
+			case x >= w.MaxTravel-margin:
+				kind, limit = Bottoming, true
+			case x <= w.MinTravel+margin:
+				kind, limit = ToppingOut, true
+			}
+			if e := open[i]; e != nil && (!limit || e.Kind != kind) {
+				w.Events = append(w.Events, *e)
+				open[i] = nil
+			}
+			if !limit {
+				continue
+			}
+			if open[i] == nil {
+				open[i] = &Event{Kind: kind, Wheel: pos, StageTime: p.StageCurrentTime, Distance: p.StageCurrentDistance, Velocity: v}
+			}
+			open[i].Duration = p.StageCurrentTime - open[i].StageTime
+		}
+	}
+	for i := range open {
+		if open[i] != nil {
+			a.Wheels[i].Events = append(a.Wheels[i].Events, *open[i])
+		}
+	}
+	if a.Time > 0 {
+		for i := range a.Wheels {
+			a.Wheels[i].AvgTravel /= a.Time
+			a.Wheels[i].AvgSpeed /= a.Time
+		}
+	}
+	fl, fr, bl, br := &a.Wheels[0], &a.Wheels[1], &a.Wheels[2], &a.Wheels[3]
+	b := &a.Balance
+	b.FrontTravel = (fl.AvgTravel + fr.AvgTravel) / 2
+	b.RearTravel = (bl.AvgTravel + br.AvgTravel) / 2
+	b.FrontSpeed = (fl.AvgSpeed + fr.AvgSpeed) / 2
+	b.RearSpeed = (bl.AvgSpeed + br.AvgSpeed) / 2
+	b.TravelDiff = b.FrontTravel - b.RearTravel
+	b.SpeedDiff = b.FrontSpeed - b.RearSpeed
+	return a
+}
@@ -0,0 +1,136 @@
+package suspension
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// drive returns packets 0.1s apart with every hub at the travel x and damper speed v.
+func drive(xs, vs []float32) []*packet.Packet {
+	packets := []*packet.Packet{}
+	for i, x := range xs {
+		p := packet.New()
+		p.GameTotalTime = float32(i) / 10
+		p.StageCurrentTime = p.GameTotalTime
+		p.StageCurrentDistance = float64(i)
+		p.VehicleHubPositionFl, p.VehicleHubPositionFr = x, x
+		p.VehicleHubPositionBl, p.VehicleHubPositionBr = x, x
+		v := vs[i]
+		p.VehicleHubVelocityFl, p.VehicleHubVelocityFr = v, v
+		p.VehicleHubVelocityBl, p.VehicleHubVelocityBr = v, v
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func negate(s []float32) []float32 {
+	n := make([]float32, len(s))
+	for i, v := range s {
+		n[i] = -v
+	}
+	return n
+}
+
+func TestHistograms(t *testing.T) {
+	xs := []float32{0, 0.015, 0.055, 0.055, 0.1, 0.1}
+	vs := []float32{0, 0.0625, 0.2125, -0.0375, -0.3125, 0.8}
+	for _, tc := range []struct {
+		name    string
+		packets []*packet.Packet
+		opts    Options
+	}{
+		{"compression positive", drive(xs, vs), Options{TravelBins: 10}},
+		{"inverted", drive(negate(xs), negate(vs)), Options{TravelBins: 10, Inverted: true}},
+	} {
+		a := Analyze(tc.packets, tc.opts)
+		if !near(a.Time, 0.5) {
+			t.Errorf("%s: time %v", tc.name, a.Time)
+		}
+		for _, w := range a.Wheels {
+			if !near(w.MinTravel, 0) || !near(w.MaxTravel, 0.1) {
+				t.Errorf("%s: %s travel %v to %v", tc.name, w.Position, w.MinTravel, w.MaxTravel)
+			}
+			travel := map[int]float64{}
+			for i, c := range w.Travel.Counts {
+				if c > 0 {
+					travel[i] = math.Round(c*10) / 10
+				}
+			}
+			if want := map[int]float64{1: 0.1, 5: 0.2, 9: 0.2}; !reflect.DeepEqual(travel, want) {
+				t.Errorf("%s: %s travel bins %v, want %v", tc.name, w.Position, travel, want)
+			}
+			velocity := map[int]float64{}
+			for i, c := range w.Velocity.Counts {
+				if c > 0 {
+					velocity[i] = math.Round(c*10) / 10
+				}
+			}
+			// the fastest rebound and bump fall in the outer bins
+			if want := map[int]float64{22: 0.1, 28: 0.1, 18: 0.1, 7: 0.1, 39: 0.1}; !reflect.DeepEqual(velocity, want) {
+				t.Errorf("%s: %s velocity bins %v, want %v", tc.name, w.Position, velocity, want)
+			}
+			if !near(w.BumpLow, 0.1) || !near(w.BumpHigh, 0.2) || !near(w.ReboundLow, 0.1) || !near(w.ReboundHigh, 0.1) {
+				t.Errorf("%s: bump %v/%v rebound %v/%v", tc.name, w.BumpLow, w.BumpHigh, w.ReboundLow, w.ReboundHigh)
+			}
+			if !near(w.AvgTravel, 0.325/5) || len(w.Events) != 0 {
+				t.Errorf("%s: average travel %v, events %v", tc.name, w.AvgTravel, w.Events)
+			}
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	xs := []float32{0.05, 0.1, 0.1, 0.1, 0.05, 0, 0, 0.05}
+	vs := []float32{0, 0.3, 0, 0, -0.2, -0.4, 0, 0}
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want []Event
+	}{
+		{"observed range", Options{}, []Event{}},
+		{"limits", Options{MinTravel: 0, MaxTravel: 0.1}, []Event{
+			{Kind: Bottoming, Wheel: packet.ForwardLeft, StageTime: 0.1, Distance: 1, Duration: 0.2, Velocity: 0.3},
+			{Kind: ToppingOut, Wheel: packet.ForwardLeft, StageTime: 0.5, Distance: 5, Duration: 0.1, Velocity: -0.4},
+		}},
+		{"longer travel", Options{MinTravel: -0.05, MaxTravel: 0.15}, []Event{}},
+	} {
+		a := Analyze(drive(xs, vs), tc.opts)
+		got := a.Wheels[0].Events
+		for i := range got {
+			got[i].Duration = float32(math.Round(float64(got[i].Duration)*10) / 10)
+			got[i].Velocity = math.Round(got[i].Velocity*10) / 10
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: events %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBalance(t *testing.T) {
+	packets := drive([]float32{0.04, 0.04, 0.04}, []float32{0.1, 0.1, -0.1})
+	for _, p := range packets {
+		p.VehicleHubPositionBl, p.VehicleHubPositionBr = 0.06, 0.06
+	}
+	b := Analyze(packets, Options{}).Balance
+	if !near(b.FrontTravel, 0.04) || !near(b.RearTravel, 0.06) || !near(b.TravelDiff, -0.02) || !near(b.SpeedDiff, 0) {
+		t.Errorf("balance %+v", b)
+	}
+}
+
+func TestNoPackets(t *testing.T) {
+	a := Analyze(nil, Options{})
+	if a.Time != 0 || a.Wheels[0].MinTravel != 0 || a.Wheels[0].MaxTravel != 0 {
+		t.Errorf("analysis %+v", a.Wheels[0])
+	}
+	if _, err := json.Marshal(a); err != nil {
+		t.Error(err)
+	}
+}
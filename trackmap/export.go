@@ -0,0 +1,179 @@
+package trackmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/nobonobo/easportswrc/compare"
+)
+
+// Colouring returns the value used to colour the map at a point.
+type Colouring func(p Point) float64
+
+// BySpeed colours by the average speed.
+func BySpeed(p Point) float64 {
+	return p.Speed
+}
+
+// ByGear colours by the average gear index.
+func ByGear(p Point) float64 {
+	return p.Gear
+}
+
+// ByDelta colours by the delta time of a comparison at the point distance.
+func ByDelta(c *compare.Comparison) Colouring {
+	return func(p Point) float64 {
+		i := sort.Search(len(c.Points), func(i int) bool { return c.Points[i].Distance >= p.Distance })
+		if len(c.Points) == 0 {
+			return 0
+		}
+		if i == len(c.Points) {
+			i--
+		}
+		return float64(c.Points[i].DeltaTime)
+	}
+}
+
+// scale maps values onto a blue to red colour ramp.
+type scale struct {
+	lo, hi float64
+}
+
+func newScale(m *Map, colour Colouring) scale {
+	s := scale{lo: math.Inf(1), hi: math.Inf(-1)}
+	for _, p := range m.Points {
+		v := colour(p)
+		s.lo, s.hi = min(s.lo, v), max(s.hi, v)
+	}
+	return s
+}
+
+func (s scale) colour(v float64) string {
+	t := 0.5
+	if s.hi > s.lo {
+		t = (v - s.lo) / (s.hi - s.lo)
+	}
+	return fmt.Sprintf("hsl(%.0f,90%%,45%%)", 240*(1-t))
+}
+
+// Options controls the exports.
+type Options struct {
+	// Colour colours the line, nil draws a single colour.
+	Colour Colouring
+	// MarkerInterval is the distance in metres between markers, 0 disables them.
+	MarkerInterval float64
+}
+
+// WriteSVG draws the map north up, scaled to fit width pixels.
+func (m *Map) WriteSVG(w io.Writer, width float64, opts Options) error {
+	if len(m.Points) < 2 {
+		return fmt.Errorf("map has no line")
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range m.Points {
+		x, y := m.Plane(p)
+		minX, maxX = min(minX, x), max(maxX, x)
+		minY, maxY = min(minY, y), max(maxY, y)
+	}
+	margin := 20.0
+	k := (width - 2*margin) / max(maxX-minX, maxY-minY, 1)
+	height := (maxY-minY)*k + 2*margin
+	xy := func(p Point) (float64, float64) {
+		x, y := m.Plane(p)
+		return margin + (x-minX)*k, height - margin - (y-minY)*k
+	}
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`+"\n", width, height, width, height)
+	fmt.Fprintf(w, "<title>%s</title>\n", html.EscapeString(m.Route))
+	if opts.Colour == nil {
+		fmt.Fprint(w, `<polyline fill="none" stroke="#222" stroke-width="3" points="`)
+		for _, p := range m.Points {
+			x, y := xy(p)
+			fmt.Fprintf(w, "%.1f,%.1f ", x, y)
+		}
+		fmt.Fprintln(w, `"/>`)
+	} else {
+		s := newScale(m, opts.Colour)
+		for i := 1; i < len(m.Points); i++ {
+			x0, y0 := xy(m.Points[i-1])
+			x1, y1 := xy(m.Points[i])
+			fmt.Fprintf(w, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="3" stroke-linecap="round"/>`+"\n",
+				x0, y0, x1, y1, s.colour(opts.Colour(m.Points[i])))
+		}
+	}
+	for _, p := range m.Markers(opts.MarkerInterval) {
+		x, y := xy(p)
+		fmt.Fprintf(w, `<circle cx="%.1f" cy="%.1f" r="4" fill="#fff" stroke="#222"/>`+"\n", x, y)
+		fmt.Fprintf(w, `<text x="%.1f" y="%.1f" font-size="12" font-family="sans-serif">%.1fkm</text>`+"\n", x+6, y-6, p.Distance/1000)
+	}
+	_, err := fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+type feature struct {
+	Type       string         `json:"type"`
+	Geometry   geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// metresPerDegree is the length of a degree of latitude.
+const metresPerDegree = 111320.0
+
+// WriteGeoJSON writes the map as a FeatureCollection. Game coordinates are
+// placed around the latitude and longitude origin with an equirectangular
+// projection so that the map opens in GIS tools at its real size.
+func (m *Map) WriteGeoJSON(w io.Writer, lat, lon float64, opts Options) error {
+	coord := func(p Point) []float64 {
+		x, y := m.Plane(p)
+		return []float64{
+			lon + x/(metresPerDegree*math.Cos(lat*math.Pi/180)),
+			lat + y/metresPerDegree,
+		}
+	}
+	features := []feature{}
+	if opts.Colour == nil {
+		line := [][]float64{}
+		for _, p := range m.Points {
+			line = append(line, coord(p))
+		}
+		features = append(features, feature{
+			Type:       "Feature",
+			Geometry:   geometry{Type: "LineString", Coordinates: line},
+			Properties: map[string]any{"route_id": m.RouteID, "route": m.Route},
+		})
+	} else {
+		s := newScale(m, opts.Colour)
+		for i := 1; i < len(m.Points); i++ {
+			v := opts.Colour(m.Points[i])
+			features = append(features, feature{
+				Type:     "Feature",
+				Geometry: geometry{Type: "LineString", Coordinates: [][]float64{coord(m.Points[i-1]), coord(m.Points[i])}},
+				Properties: map[string]any{
+					"distance": m.Points[i].Distance,
+					"value":    v,
+					"stroke":   s.colour(v),
+				},
+			})
+		}
+	}
+	for _, p := range m.Markers(opts.MarkerInterval) {
+		features = append(features, feature{
+			Type:       "Feature",
+			Geometry:   geometry{Type: "Point", Coordinates: coord(p)},
+			Properties: map[string]any{"distance": p.Distance},
+		})
+	}
+	return json.NewEncoder(w).Encode(map[string]any{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+}
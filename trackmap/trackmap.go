@@ -0,0 +1,203 @@
+// Package trackmap builds stage maps from the recorded vehicle positions.
+package trackmap
+
+import (
+	"math"
+	"sort"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// Point is the centreline at a stage distance, averaged over the runs.
+type Point struct {
+	Distance float64 `json:"distance"`
+	// X, Y and Z are world coordinates in metres.
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Z     float64 `json:"z"`
+	Speed float64 `json:"speed"`
+	Gear  float64 `json:"gear"`
+}
+
+// Map is the centreline of a route.
+type Map struct {
+	RouteID uint16  `json:"route_id"`
+	Route   string  `json:"route"`
+	Runs    int     `json:"runs"`
+	Points  []Point `json:"points"`
+	// Up is the world axis closest to vertical, 0 for X, 1 for Y and 2 for Z.
+	Up int `json:"up"`
+}
+
+// Plane returns the horizontal coordinates of p, east and north when Up is Y.
+func (m *Map) Plane(p Point) (float64, float64) {
+	switch m.Up {
+	case 0:
+		return p.Y, p.Z
+	case 2:
+		return p.X, p.Y
+	}
+	return p.X, p.Z
+}
+
+// At returns the centreline point nearest to distance d.
+func (m *Map) At(d float64) (Point, bool) {
+	if len(m.Points) == 0 {
+		return Point{}, false
+	}
+	i := sort.Search(len(m.Points), func(i int) bool { return m.Points[i].Distance >= d })
+	if i == len(m.Points) {
+		i--
+	}
+	if i > 0 && d-m.Points[i-1].Distance < m.Points[i].Distance-d {
+		i--
+	}
+	return m.Points[i], true
+}
+
+type bin struct {
+	xs, ys, zs []float64
+	speed      float64
+	gear       float64
+	n          int
+}
+
+type route struct {
+	name string
+	bins map[int]*bin
+	up   [3]float64
+	runs int
+}
+
+// Builder accumulates positions per route across runs.
+type Builder struct {
+	// Resolution is the distance in metres between centreline points. Default 2.
+	Resolution float64
+	// Smoothing is the half width in points of the moving average. Default 2.
+	Smoothing int
+
+	routes map[uint16]*route
+}
+
+func NewBuilder() *Builder {
+	return &Builder{Resolution: 2, Smoothing: 2, routes: map[uint16]*route{}}
+}
+
+// Add accumulates the positions of one run by stage distance.
+// Excursions of single runs are removed by the median taken in Map.
+func (b *Builder) Add(packets []*packet.Packet) {
+	if len(packets) == 0 {
+		return
+	}
+	id := packets[0].RouteID
+	r, ok := b.routes[id]
+	if !ok {
+		r = &route{name: packets[0].Route(), bins: map[int]*bin{}}
+		b.routes[id] = r
+	}
+	r.runs++
+	for _, p := range packets {
+		if p.RouteID != id || p.StageCurrentDistance <= 0 {
+			continue
+		}
+		k := int(p.StageCurrentDistance / b.Resolution)
+		bn, ok := r.bins[k]
+		if !ok {
+			bn = &bin{}
+			r.bins[k] = bn
+		}
+		bn.xs = append(bn.xs, float64(p.VehiclePositionX))
+		bn.ys = append(bn.ys, float64(p.VehiclePositionY))
+		bn.zs = append(bn.zs, float64(p.VehiclePositionZ))
+		bn.speed += float64(p.VehicleSpeed)
+		bn.gear += float64(p.VehicleGearIndex)
+		bn.n++
+		r.up[0] += math.Abs(float64(p.VehicleUpDirectionX))
+		r.up[1] += math.Abs(float64(p.VehicleUpDirectionY))
+		r.up[2] += math.Abs(float64(p.VehicleUpDirectionZ))
+	}
+}
+
+// Routes returns the IDs of the routes added.
+func (b *Builder) Routes() []uint16 {
+	ids := []uint16{}
+	for id := range b.routes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func median(v []float64) float64 {
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// Map returns the cleaned centreline of a route: the median position of
+// every bin smoothed with a moving average. ok is false for unknown routes.
+func (b *Builder) Map(routeID uint16) (*Map, bool) {
+	r, ok := b.routes[routeID]
+	if !ok {
+		return nil, false
+	}
+	m := &Map{RouteID: routeID, Route: r.name, Runs: r.runs, Up: 1}
+	if r.up[0] > r.up[m.Up] {
+		m.Up = 0
+	}
+	if r.up[2] > r.up[m.Up] {
+		m.Up = 2
+	}
+	keys := []int{}
+	for k := range r.bins {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	raw := make([]Point, 0, len(keys))
+	for _, k := range keys {
+		bn := r.bins[k]
+		raw = append(raw, Point{
+			Distance: (float64(k) + 0.5) * b.Resolution,
+			X:        median(bn.xs),
+			Y:        median(bn.ys),
+			Z:        median(bn.zs),
+			Speed:    bn.speed / float64(bn.n),
+			Gear:     bn.gear / float64(bn.n),
+		})
+	}
+	m.Points = make([]Point, len(raw))
+	for i := range raw {
+		lo, hi := max(0, i-b.Smoothing), min(len(raw)-1, i+b.Smoothing)
+		p := raw[i]
+		p.X, p.Y, p.Z = 0, 0, 0
+		for j := lo; j <= hi; j++ {
+			p.X += raw[j].X
+			p.Y += raw[j].Y
+			p.Z += raw[j].Z
+		}
+		n := float64(hi - lo + 1)
+		p.X, p.Y, p.Z = p.X/n, p.Y/n, p.Z/n
+		m.Points[i] = p
+	}
+	return m, true
+}
+
+// Markers returns the centreline points every interval metres of stage distance.
+func (m *Map) Markers(interval float64) []Point {
+	res := []Point{}
+	if len(m.Points) == 0 || interval <= 0 {
+		return res
+	}
+	last := m.Points[len(m.Points)-1].Distance
+	for d := interval; d <= last; d += interval {
+		if p, ok := m.At(d); ok {
+			p.Distance = d
+			res = append(res, p)
+		}
+	}
+	return res
+}
@@ -0,0 +1,131 @@
+package trackmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// run drives north along Z for 400 m on a route, off X by offset
+// between 100 and 120 m.
+func run(routeID uint16, speed float32, offset float32) []*packet.Packet {
+	packets := []*packet.Packet{}
+	for d := 0.25; d < 400; d += 0.5 {
+		p := packet.New()
+		p.RouteID = routeID
+		p.StageCurrentDistance = d
+		p.VehiclePositionZ = float32(d)
+		p.VehiclePositionY = 10
+		if d >= 100 && d < 120 {
+			p.VehiclePositionX = offset
+		}
+		p.VehicleUpDirectionY = 1
+		p.VehicleSpeed = speed
+		p.VehicleGearIndex = 3
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func TestMap(t *testing.T) {
+	b := NewBuilder()
+	b.Add(run(7, 20, 0))
+	b.Add(run(7, 30, 0))
+	// one run off the road must not move the centreline
+	b.Add(run(7, 25, 50))
+	b.Add(run(9, 25, 0))
+	if ids := b.Routes(); len(ids) != 2 || ids[0] != 7 || ids[1] != 9 {
+		t.Errorf("routes %v", ids)
+	}
+	if _, ok := b.Map(8); ok {
+		t.Error("map of an unknown route")
+	}
+	m, ok := b.Map(7)
+	if !ok {
+		t.Fatal("no map")
+	}
+	if m.Runs != 3 || m.Up != 1 || len(m.Points) != 200 {
+		t.Fatalf("%d runs, up %d, %d points", m.Runs, m.Up, len(m.Points))
+	}
+	for i, p := range m.Points {
+		if p.Distance != float64(i)*2+1 {
+			t.Fatalf("point %d at %v", i, p.Distance)
+		}
+		if p.X != 0 || p.Y != 10 || p.Speed != 25 || p.Gear != 3 {
+			t.Errorf("point %+v", p)
+		}
+	}
+	// the moving average of the ends only has neighbours on one side
+	if p := m.Points[0]; math.Abs(p.Z-3) > 1e-9 {
+		t.Errorf("first point z %v, want 3", p.Z)
+	}
+	if p := m.Points[100]; math.Abs(p.Z-201) > 1e-9 {
+		t.Errorf("point at 201 m z %v, want 201", p.Z)
+	}
+	for _, tc := range []struct{ d, want float64 }{{-5, 1}, {2.9, 3}, {9.9, 9}, {1000, 399}} {
+		if p, _ := m.At(tc.d); p.Distance != tc.want {
+			t.Errorf("at %v: %v, want %v", tc.d, p.Distance, tc.want)
+		}
+	}
+	markers := m.Markers(100)
+	if len(markers) != 3 || markers[0].Distance != 100 || markers[2].Distance != 300 {
+		t.Errorf("markers %+v", markers)
+	}
+}
+
+func TestExport(t *testing.T) {
+	b := NewBuilder()
+	b.Add(run(7, 20, 0))
+	m, _ := b.Map(7)
+	buf := &bytes.Buffer{}
+	if err := m.WriteSVG(buf, 400, Options{MarkerInterval: 100}); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	if strings.Count(svg, "<polyline") != 1 || strings.Count(svg, "<circle") != 3 || !strings.HasSuffix(svg, "</svg>\n") {
+		t.Errorf("svg %s", svg)
+	}
+	buf.Reset()
+	if err := m.WriteSVG(buf, 400, Options{Colour: BySpeed}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "<line"); n != len(m.Points)-1 {
+		t.Errorf("%d coloured segments, want %d", n, len(m.Points)-1)
+	}
+	if err := (&Map{}).WriteSVG(buf, 400, Options{}); err == nil {
+		t.Error("empty map drawn")
+	}
+
+	buf.Reset()
+	if err := m.WriteGeoJSON(buf, 60, 25, Options{MarkerInterval: 100}); err != nil {
+		t.Fatal(err)
+	}
+	var fc struct {
+		Type     string
+		Features []struct {
+			Geometry struct {
+				Type        string
+				Coordinates json.RawMessage
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 4 || fc.Features[0].Geometry.Type != "LineString" {
+		t.Fatalf("geojson %s", buf.Bytes())
+	}
+	line := [][]float64{}
+	if err := json.Unmarshal(fc.Features[0].Geometry.Coordinates, &line); err != nil {
+		t.Fatal(err)
+	}
+	// 400 m north of the origin is about 0.0036 degrees of latitude
+	first, last := line[0], line[len(line)-1]
+	if first[0] != 25 || math.Abs((last[1]-first[1])*metresPerDegree-(m.Points[len(m.Points)-1].Z-m.Points[0].Z)) > 1e-6 {
+		t.Errorf("line from %v to %v", first, last)
+	}
+}
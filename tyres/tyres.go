@@ -0,0 +1,67 @@
+// Package tyres reports tyre state changes such as punctures and lost tyres.
+package tyres
+
+import (
+	"fmt"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+// Event is a tyre state transition and where it happened.
+type Event struct {
+	Wheel     packet.Position `json:"wheel"`
+	From      uint8           `json:"from"`
+	To        uint8           `json:"to"`
+	FromName  string          `json:"from_name"`
+	ToName    string          `json:"to_name"`
+	StageTime float32         `json:"stage_time"`
+	Distance  float64         `json:"distance"`
+	GameTime  float32         `json:"game_time"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("tyre%s %s -> %s at %.0fm %.3fs", e.Wheel, e.FromName, e.ToName, e.Distance, e.StageTime)
+}
+
+// Detector compares the tyre states of successive packets.
+type Detector struct {
+	last *packet.Packet
+}
+
+func NewDetector() *Detector {
+	return &Detector{}
+}
+
+// Update consumes a packet and returns the transitions since the previous one.
+func (d *Detector) Update(p *packet.Packet) []Event {
+	last := d.last
+	// keep a copy, callers may decode every datagram into the same packet
+	cp := *p
+	d.last = &cp
+	if last == nil {
+		return nil
+	}
+	events := []Event{}
+	for _, pos := range packet.Positions {
+		from, to := last.TyreStateID(pos), p.TyreStateID(pos)
+		if from == to {
+			continue
+		}
+		events = append(events, Event{
+			Wheel:     pos,
+			From:      from,
+			To:        to,
+			FromName:  last.VehicleTyreState(pos),
+			ToName:    p.VehicleTyreState(pos),
+			StageTime: p.StageCurrentTime,
+			Distance:  p.StageCurrentDistance,
+			GameTime:  p.GameTotalTime,
+		})
+	}
+	return events
+}
+
+// Reset forgets the previous packet, for example at a restart where tyres are replaced.
+func (d *Detector) Reset() {
+	d.last = nil
+}
@@ -0,0 +1,48 @@
+package tyres
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nobonobo/easportswrc/packet"
+)
+
+func TestDetector(t *testing.T) {
+	d := NewDetector()
+	// one packet decoded into again and again, as by a receiver
+	p := packet.New()
+	update := func(distance float64, set func()) []Event {
+		t.Helper()
+		set()
+		p.StageCurrentDistance = distance
+		return d.Update(p)
+	}
+	if ev := update(0, func() {}); len(ev) != 0 {
+		t.Errorf("events %v on the first packet", ev)
+	}
+	if ev := update(10, func() {}); len(ev) != 0 {
+		t.Errorf("events %v without a change", ev)
+	}
+	ev := update(20, func() { p.VehicleTyreStateFr, p.VehicleTyreStateBl = 1, 2 })
+	want := []Event{
+		{Wheel: packet.ForwardRight, From: 0, To: 1, Distance: 20},
+		{Wheel: packet.BackwordLeft, From: 0, To: 2, Distance: 20},
+	}
+	for i := range ev {
+		if ev[i].FromName == "" || ev[i].ToName != p.VehicleTyreState(ev[i].Wheel) {
+			t.Errorf("names %s -> %s", ev[i].FromName, ev[i].ToName)
+		}
+		ev[i].FromName, ev[i].ToName = "", ""
+	}
+	if !reflect.DeepEqual(ev, want) {
+		t.Errorf("events %v, want %v", ev, want)
+	}
+	if ev := update(30, func() {}); len(ev) != 0 {
+		t.Errorf("events %v repeated", ev)
+	}
+	// tyres are replaced at a restart
+	d.Reset()
+	if ev := update(0, func() { p.VehicleTyreStateFr, p.VehicleTyreStateBl = 0, 0 }); len(ev) != 0 {
+		t.Errorf("events %v after a reset", ev)
+	}
+}